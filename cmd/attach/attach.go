@@ -0,0 +1,205 @@
+package attach
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxSize is the size above which files are skipped when no other limit is set.
+const DefaultMaxSize = 1 << 20
+
+// MaxImageSize is the size above which images are skipped, whatever MaxSize
+// is. Providers reject larger images anyway.
+const MaxImageSize = 5 << 20
+
+// imageTypes are the MIME types of the images sent to vision models.
+var imageTypes = []string{"image/png", "image/jpeg", "image/webp", "image/gif"}
+
+// sniffLen is how much of a file is looked at to tell text from binary.
+const sniffLen = 8000
+
+// File is a file attached to a question.
+type File struct {
+	Path    string
+	Content []byte
+	// MIMEType is set for images, which are sent as images rather than text.
+	MIMEType string
+}
+
+// Options controls which files Collect keeps.
+type Options struct {
+	// MaxSize is the size in bytes above which a file is skipped, DefaultMaxSize when zero.
+	MaxSize int64
+}
+
+// Collect returns the files named by the patterns, which can be file paths,
+// globs or directories. Directories are walked recursively, skipping the files
+// ignored by .gitignore. Binary and oversized files are skipped, each with a
+// warning. A pattern matching nothing is an error.
+func Collect(patterns []string, opts Options) ([]File, []string, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+
+	c := &collector{opts: opts, seen: map[string]bool{}}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("no file matches %q", pattern)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, nil, err
+			}
+			if info.IsDir() {
+				err = c.walk(match)
+			} else {
+				err = c.add(match, info)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return c.files, c.warnings, nil
+}
+
+type collector struct {
+	opts     Options
+	seen     map[string]bool
+	files    []File
+	warnings []string
+}
+
+func (c *collector) walk(root string) error {
+	// The rules in effect in every directory walked, each one seeing the
+	// .gitignore files of its own ancestors only.
+	ancestors := ancestorIgnores(root)
+	ignoresIn := map[string]ignoreRules{}
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ignores := ancestors
+		if path != root {
+			ignores = ignoresIn[filepath.Dir(path)]
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if path != root && ignores.ignored(path, true) {
+				return filepath.SkipDir
+			}
+			ignoresIn[path] = ignores.load(path)
+			return nil
+		}
+		if ignores.ignored(path, false) || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return c.add(path, info)
+	})
+}
+
+func (c *collector) add(path string, info fs.FileInfo) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		if c.seen[abs] {
+			return nil
+		}
+		c.seen[abs] = true
+	}
+
+	mimeType, err := imageType(path)
+	if err != nil {
+		return err
+	}
+	limit := c.opts.MaxSize
+	if mimeType != "" {
+		limit = MaxImageSize
+	}
+	if info.Size() > limit {
+		c.warnings = append(c.warnings, fmt.Sprintf("skipping %s: %d bytes is over the %d bytes limit", path, info.Size(), limit))
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if mimeType != "" {
+		c.files = append(c.files, File{Path: path, Content: content, MIMEType: mimeType})
+		return nil
+	}
+	if Binary(content) {
+		c.warnings = append(c.warnings, fmt.Sprintf("skipping %s: binary file", path))
+		return nil
+	}
+	c.files = append(c.files, File{Path: path, Content: content})
+	return nil
+}
+
+// imageType returns the MIME type of the file when it is an image vision
+// models accept, going by its content rather than its extension.
+func imageType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	mimeType := http.DetectContentType(head[:n])
+	for _, t := range imageTypes {
+		if mimeType == t {
+			return mimeType, nil
+		}
+	}
+	return "", nil
+}
+
+// Binary reports whether the content looks like binary data rather than text:
+// it holds a NUL byte or isn't valid UTF-8 near its start.
+func Binary(content []byte) bool {
+	sniff := content
+	if len(sniff) > sniffLen {
+		sniff = sniff[:sniffLen]
+		// Don't mistake a multi-byte character cut at the limit for invalid UTF-8.
+		for i := 0; i < utf8.UTFMax && len(sniff) > 0 && !utf8.RuneStart(content[len(sniff)]); i++ {
+			sniff = sniff[:len(sniff)-1]
+		}
+	}
+	return bytes.IndexByte(sniff, 0) >= 0 || !utf8.Valid(sniff)
+}
+
+// Format wraps every text file in a section delimited by its path. Images are left out.
+func Format(files []File) string {
+	sections := make([]string, 0, len(files))
+	for _, f := range files {
+		if f.MIMEType != "" {
+			continue
+		}
+		content := strings.TrimRight(string(f.Content), "\n")
+		sections = append(sections, fmt.Sprintf("--- %s ---\n%s\n--- end of %s ---", f.Path, content, f.Path))
+	}
+	return strings.Join(sections, "\n\n")
+}
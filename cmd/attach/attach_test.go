@@ -0,0 +1,137 @@
+package attach
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates the files under dir, creating their directories as needed.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func paths(files []File, dir string) string {
+	var names []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f.Path)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCollectDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".git/HEAD":           "ref: refs/heads/main",
+		".gitignore":          "*.log\nbuild/\n/secret.txt\ndocs/**/draft.md\n!keep.log\n",
+		"main.go":             "package main",
+		"debug.log":           "noise",
+		"keep.log":            "kept",
+		"secret.txt":          "hunter2",
+		"build/out.txt":       "generated",
+		"docs/guide.md":       "# Guide",
+		"docs/old/draft.md":   "draft",
+		"pkg/.gitignore":      "*.tmp\n",
+		"pkg/lib.go":          "package pkg",
+		"pkg/cache.tmp":       "cache",
+		"pkg/secret.txt":      "not anchored here",
+		"pkg/image.bin":       "\x00\x01\x02",
+		"pkg/big.txt":         strings.Repeat("x", 100),
+		"pkg/nested/util.go":  "package nested",
+		"pkg/nested/util.tmp": "cache",
+		"tools/gen.tmp":       "pkg/.gitignore doesn't apply here",
+	})
+
+	files, warnings, err := Collect([]string{dir}, Options{MaxSize: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ".gitignore,docs/guide.md,keep.log,main.go,pkg/.gitignore,pkg/lib.go,pkg/nested/util.go,pkg/secret.txt,tools/gen.tmp"
+	if got := paths(files, dir); got != want {
+		t.Errorf("got files %s, want %s", got, want)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "big.txt") || !strings.Contains(warnings[1], "image.bin") {
+		t.Errorf("got warnings %q, want the oversized and the binary file", warnings)
+	}
+}
+
+func TestCollectPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.go": "package a", "b.go": "package b", "notes.md": "notes"})
+
+	files, _, err := Collect([]string{filepath.Join(dir, "*.go"), filepath.Join(dir, "a.go"), filepath.Join(dir, "notes.md")}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(files, dir); got != "a.go,b.go,notes.md" {
+		t.Errorf("got files %s, want every file once", got)
+	}
+
+	if _, _, err := Collect([]string{filepath.Join(dir, "*.rs")}, Options{}); err == nil {
+		t.Error("a pattern matching nothing was accepted")
+	}
+}
+
+func TestBinary(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content string
+		want    bool
+	}{
+		"text":     {"hello\n", false},
+		"utf-8":    {"héllo wörld ✓", false},
+		"nul":      {"hello\x00world", true},
+		"latin-1":  {"caf\xe9", true},
+		"cut rune": {strings.Repeat("a", sniffLen-1) + "é", false},
+		"empty":    {"", false},
+	} {
+		if got := Binary([]byte(tc.content)); got != tc.want {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format([]File{{Path: "a.go", Content: []byte("package a\n")}, {Path: "b.md", Content: []byte("# B")}})
+	want := "--- a.go ---\npackage a\n--- end of a.go ---\n\n--- b.md ---\n# B\n--- end of b.md ---"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCollectImages(t *testing.T) {
+	dir := t.TempDir()
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 200)
+	writeTree(t, dir, map[string]string{"screenshot.png": png, "renamed.dat": png, "notes.txt": "notes"})
+
+	files, warnings, err := Collect([]string{dir}, Options{MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("got warnings %q, want images to be kept over MaxSize", warnings)
+	}
+	for _, f := range files {
+		wantType := "image/png"
+		if f.Path == filepath.Join(dir, "notes.txt") {
+			wantType = ""
+		}
+		if f.MIMEType != wantType {
+			t.Errorf("%s: got MIME type %q, want %q", f.Path, f.MIMEType, wantType)
+		}
+	}
+	if got := Format(files); !strings.Contains(got, "notes.txt") || strings.Contains(got, "PNG") {
+		t.Errorf("got %q, want only the text file", got)
+	}
+}
@@ -0,0 +1,148 @@
+package attach
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is a pattern read from a .gitignore file, see
+// https://git-scm.com/docs/gitignore#_pattern_format
+type ignoreRule struct {
+	// base is the absolute directory holding the .gitignore file.
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+	// anchored patterns contain a slash and match the path relative to base,
+	// the other ones match the name of the file at any depth.
+	anchored bool
+}
+
+// ignoreRules are the rules in effect for a directory, outermost file first.
+type ignoreRules []ignoreRule
+
+// ancestorIgnores returns the rules of the .gitignore files above dir, up to
+// the root of the git repository holding it. Outside of a repository there
+// are none.
+func ancestorIgnores(dir string) ignoreRules {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+
+	var parents []string
+	for current := abs; !repositoryRoot(current); {
+		parent := filepath.Dir(current)
+		if parent == current {
+			// Reached the filesystem root without finding a repository.
+			return nil
+		}
+		current = parent
+		parents = append(parents, current)
+	}
+
+	var rules ignoreRules
+	for i := len(parents) - 1; i >= 0; i-- {
+		rules = rules.load(parents[i])
+	}
+	return rules
+}
+
+// load returns the rules with the ones of the .gitignore file in dir, if any, appended.
+func (rules ignoreRules) load(dir string) ignoreRules {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return rules
+	}
+	f, err := os.Open(filepath.Join(abs, ".gitignore"))
+	if err != nil {
+		return rules
+	}
+	defer f.Close()
+
+	// Copy so that sibling directories don't share the appended rules.
+	loaded := append(ignoreRules{}, rules...)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: abs}
+		if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+			line = line[1:]
+		}
+		if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+			line = strings.TrimSuffix(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern != "" {
+			loaded = append(loaded, rule)
+		}
+	}
+	return loaded
+}
+
+// ignored reports whether the file or directory at name is ignored. The last
+// matching rule wins, so negated patterns can re-include a file.
+func (rules ignoreRules) ignored(name string, isDir bool) bool {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, abs)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		var matched bool
+		if rule.anchored {
+			matched = matchSegments(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches a path against a pattern, one segment at a time.
+// A ** segment matches any number of segments.
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+func repositoryRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/attach"
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/markdown"
+	"github.com/avinashsivaraman/gq/cmd/session"
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const chatCommandsHelp = `Slash commands:
+    /provider [name]      show or switch the provider
+    /model [name]         show or switch the model
+    /temperature [value]  show or set the temperature
+    /load <path>          attach a file, glob or directory to the next message
+    /save <name>          save the conversation as a session (see gq session)
+    /reset                forget the conversation history
+    /help                 list the slash commands
+    /exit                 leave the chat`
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Start an interactive chat",
+	Long: `
+  Opens an interactive chat that keeps the conversation history and streams the replies.
+
+  ` + chatCommandsHelp + `
+    `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := settingsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		return runChat(settings)
+	},
+}
+
+// chatState is everything the REPL keeps between two lines of input.
+type chatState struct {
+	provider string
+	options  llm.Options
+	// system is the system prompt sent ahead of the conversation, see --system and --persona.
+	system string
+	// usage is the format of the usage summary printed after every answer, see --usage.
+	usage string
+	// renderer renders the markdown of the replies, nil when they are printed raw.
+	renderer *markdown.Renderer
+	messages []llm.Message
+	// attachments are prepended to the next message sent, see /load.
+	attachments []string
+	// images are sent with the next message, see /load.
+	images []llm.Image
+}
+
+/**
+* This function runs the interactive chat until the user exits
+ */
+func runChat(settings callSettings) error {
+	provider := settings.provider
+	if provider == "" {
+		provider = viper.GetString("default")
+	}
+	if provider == "" {
+		return llm.ConfigError("", "no provider selected. Use -p or set default in the config file")
+	}
+	if _, err := newChatProvider(provider); err != nil {
+		return err
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          "\033[38;5;148mgq>\033[0m ",
+		HistoryFile:     chatHistoryFile(),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	state := &chatState{
+		provider: provider,
+		options:  settings.options,
+		system:   settings.system,
+		usage:    settings.usage,
+		renderer: settings.renderer,
+	}
+
+	fmt.Printf("\033[33mChatting with %s. Type /help for commands, /exit to leave.\033[0m\n", provider)
+
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			done, err := state.command(os.Stdout, line)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "\033[31m"+err.Error()+"\033[0m")
+			}
+			if done {
+				return nil
+			}
+			continue
+		}
+
+		if err := state.send(line); err != nil {
+			renderError(os.Stderr, err)
+		}
+	}
+}
+
+/**
+* This function sends a message with the conversation history and streams the reply.
+* Ctrl+C cancels the reply in flight without leaving the chat.
+ */
+func (state *chatState) send(line string) error {
+	content := strings.Join(append(state.attachments, line), "\n\n")
+	messages := append(state.messages, llm.Message{Role: llm.RoleUser, Content: content, Images: state.images})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	out, flush := answerWriter(os.Stdout, state.renderer)
+	answer, err := sendChat(ctx, state.provider, llm.ChatRequest{
+		Messages: withSystemPrompt(state.system, messages),
+		Options:  state.options,
+		Stream:   streamTo(out, false),
+	})
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	state.attachments = nil
+	state.images = nil
+	state.messages = append(messages, llm.Message{Role: llm.RoleAssistant, Content: answer.Text})
+	return reportUsage(state.usage, state.provider, state.options, answer.Usage)
+}
+
+/**
+* This function runs a slash command, printing its output to w. It returns
+* true when the chat should end.
+ */
+func (state *chatState) command(w io.Writer, line string) (bool, error) {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/exit", "/quit":
+		return true, nil
+	case "/help":
+		fmt.Fprintln(w, chatCommandsHelp)
+	case "/provider":
+		if arg == "" {
+			fmt.Fprintln(w, state.provider)
+			return false, nil
+		}
+		if _, err := newChatProvider(arg); err != nil {
+			return false, err
+		}
+		state.provider = arg
+		state.options.Model = ""
+		fmt.Fprintf(w, "\033[33mSwitched to %s\033[0m\n", arg)
+	case "/model":
+		if arg == "" {
+			fmt.Fprintln(w, modelName(state.provider, state.options))
+			return false, nil
+		}
+		state.options.Model = arg
+		fmt.Fprintf(w, "\033[33mUsing model %s\033[0m\n", arg)
+	case "/temperature":
+		if arg == "" {
+			if state.options.Temperature != nil {
+				fmt.Fprintln(w, *state.options.Temperature)
+			} else {
+				section, _ := providerSection(state.provider)
+				fmt.Fprintln(w, viper.GetFloat64(section+".temperature"))
+			}
+			return false, nil
+		}
+		temperature, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid temperature %q", arg)
+		}
+		state.options.Temperature = &temperature
+		fmt.Fprintf(w, "\033[33mTemperature set to %v\033[0m\n", temperature)
+	case "/reset":
+		state.messages = nil
+		state.attachments = nil
+		state.images = nil
+		fmt.Fprintln(w, "\033[33mConversation history cleared\033[0m")
+	case "/load":
+		if arg == "" {
+			return false, errors.New("usage: /load <file, glob or directory>")
+		}
+		files, warnings, err := attach.Collect([]string{arg}, attach.Options{MaxSize: viper.GetInt64("files.maxSize")})
+		if err != nil {
+			return false, err
+		}
+		printWarnings(warnings)
+		if len(files) == 0 {
+			return false, fmt.Errorf("no file to load from %s", arg)
+		}
+		if text := attach.Format(files); text != "" {
+			state.attachments = append(state.attachments, text)
+		}
+		state.images = append(state.images, images(files)...)
+		fmt.Fprintf(w, "\033[33mLoaded %d file(s) from %s. They will be sent with your next message\033[0m\n", len(files), arg)
+	case "/save":
+		if arg == "" {
+			return false, errors.New("usage: /save <session name>")
+		}
+		store, err := session.NewStore()
+		if err != nil {
+			return false, err
+		}
+		conversation, err := store.Load(arg)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		conversation.Provider = state.provider
+		conversation.Messages = state.messages
+		if err := store.Save(conversation); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "\033[33mSaved as session %s. Continue it with gq -s %s\033[0m\n", arg, arg)
+	default:
+		return false, fmt.Errorf("unknown command %s. Type /help for the list of commands", name)
+	}
+	return false, nil
+}
+
+/**
+* This function returns the readline history file, in the state directory of
+* gq like the sessions and the usage ledger. The chat runs without history
+* when the directory can't be created.
+ */
+func chatHistoryFile() string {
+	dir, err := session.StateDir()
+	if err != nil {
+		return ""
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return ""
+	}
+	return filepath.Join(dir, ".chat_history")
+}
+
+func init() {
+	rootCmd.AddCommand(chatCmd)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/session"
+)
+
+func TestChatCommand(t *testing.T) {
+	loadTestConfig(t, "ollama:\n  modelName: llama3\n  temperature: 0.2\n")
+	if err := os.WriteFile("notes.txt", []byte("remember the milk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		line    string
+		done    bool
+		wantErr string
+		// check tells whether the state and the output are the expected ones.
+		check func(state *chatState, out string) bool
+	}{
+		{line: "/exit", done: true},
+		{line: "/quit", done: true},
+		{line: "/help", check: func(state *chatState, out string) bool { return out == chatCommandsHelp+"\n" }},
+		{line: "/provider", check: func(state *chatState, out string) bool { return out == "ollama\n" }},
+		{line: "/provider gemini", check: func(state *chatState, out string) bool {
+			return state.provider == "gemini" && state.options.Model == ""
+		}},
+		{line: "/provider nope", wantErr: "unknown provider", check: func(state *chatState, out string) bool { return state.provider == "ollama" }},
+		{line: "/model", check: func(state *chatState, out string) bool { return out == "mistral\n" }},
+		{line: "/model llama3.1", check: func(state *chatState, out string) bool { return state.options.Model == "llama3.1" }},
+		{line: "/temperature", check: func(state *chatState, out string) bool { return out == "0.2\n" }},
+		{line: "/temperature 0.7", check: func(state *chatState, out string) bool {
+			return state.options.Temperature != nil && *state.options.Temperature == 0.7
+		}},
+		{line: "/temperature hot", wantErr: "invalid temperature", check: func(state *chatState, out string) bool { return state.options.Temperature == nil }},
+		{line: "/reset", check: func(state *chatState, out string) bool { return len(state.messages) == 0 }},
+		{line: "/load", wantErr: "usage: /load"},
+		{line: "/load missing.txt", wantErr: "missing.txt"},
+		{line: "/load notes.txt", check: func(state *chatState, out string) bool {
+			return len(state.attachments) == 1 && strings.Contains(state.attachments[0], "remember the milk")
+		}},
+		{line: "/save", wantErr: "usage: /save"},
+		{line: "/save ../s1", wantErr: "invalid session name"},
+		{line: "/save s1", check: func(state *chatState, out string) bool {
+			store, err := session.NewStore()
+			if err != nil {
+				return false
+			}
+			saved, err := store.Load("s1")
+			return err == nil && saved.Provider == "ollama" && len(saved.Messages) == 2 && strings.Contains(out, "gq -s s1")
+		}},
+		{line: "/bogus", wantErr: "unknown command /bogus"},
+	} {
+		state := &chatState{
+			provider: "ollama",
+			options:  llm.Options{Model: "mistral"},
+			messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}, {Role: llm.RoleAssistant, Content: "hello"}},
+		}
+		if strings.HasPrefix(tc.line, "/temperature") {
+			state.options = llm.Options{}
+		}
+
+		var out bytes.Buffer
+		done, err := state.command(&out, tc.line)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.line, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: got error %v, want one about %q", tc.line, err, tc.wantErr)
+		}
+		if done != tc.done {
+			t.Errorf("%s: got done %v, want %v", tc.line, done, tc.done)
+		}
+		if tc.check != nil && !tc.check(state, out.String()) {
+			t.Errorf("%s: unexpected state %+v and output %q", tc.line, state, out.String())
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(os.Getenv("XDG_STATE_HOME"), "gq", "sessions", "s1.json")); err != nil {
+		t.Errorf("the session wasn't saved in the state directory: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/markdown"
+	"github.com/spf13/cobra"
+)
+
+// codeSelection is the code blocks of the answer to print or write, see --code.
+type codeSelection struct {
+	// lang keeps the blocks of the language only, see --code-lang.
+	lang string
+	// index keeps the index-th block only, counting from 1, 0 for every block.
+	index int
+	// out is the directory the blocks are written to instead of stdout, see --code-out.
+	out string
+}
+
+// codeNotFoundError is returned when the answer holds no code block matching the selection.
+type codeNotFoundError struct {
+	message string
+}
+
+func (e *codeNotFoundError) Error() string {
+	return e.message
+}
+
+/**
+* This function returns the code blocks selected with the --code flags, or nil
+* when none of them is set. --code-lang, --code-index and --code-out imply --code.
+ */
+func codeFromFlags(cmd *cobra.Command) (*codeSelection, error) {
+	flags := cmd.Flags()
+	code, _ := flags.GetBool("code")
+	selection := &codeSelection{}
+	selection.lang, _ = flags.GetString("code-lang")
+	selection.index, _ = flags.GetInt("code-index")
+	selection.out, _ = flags.GetString("code-out")
+	if flags.Changed("code-index") && selection.index < 1 {
+		return nil, newUsageError("--code-index counts from 1, got %d", selection.index)
+	}
+	if !code && selection.lang == "" && selection.index == 0 && selection.out == "" {
+		return nil, nil
+	}
+	return selection, nil
+}
+
+/**
+* This function returns the code blocks of the answer matching the selection
+ */
+func selectCode(answer string, selection codeSelection) ([]markdown.CodeBlock, error) {
+	blocks := markdown.CodeBlocks(answer)
+	what := "code block"
+	if selection.lang != "" {
+		what = selection.lang + " code block"
+		var matching []markdown.CodeBlock
+		for _, block := range blocks {
+			if sameLanguage(block.Lang, selection.lang) {
+				matching = append(matching, block)
+			}
+		}
+		blocks = matching
+	}
+
+	if len(blocks) == 0 {
+		return nil, &codeNotFoundError{message: "the answer holds no " + what}
+	}
+	if selection.index > len(blocks) {
+		return nil, &codeNotFoundError{message: fmt.Sprintf("the answer holds %d %s(s), there is no block %d", len(blocks), what, selection.index)}
+	}
+	if selection.index > 0 {
+		blocks = blocks[selection.index-1 : selection.index]
+	}
+	return blocks, nil
+}
+
+/**
+* This function reports whether two languages of info strings are the same,
+* e.g. bash and sh
+ */
+func sameLanguage(lang string, other string) bool {
+	if lang == "" {
+		return false
+	}
+	return strings.EqualFold(lang, other) || markdown.Extension(lang) == markdown.Extension(other) && markdown.Extension(lang) != "txt"
+}
+
+/**
+* This function prints the code blocks of the answer selected with --code, or
+* writes them to the --code-out directory and prints the paths of the files.
+ */
+func writeCode(answer string, selection codeSelection, verbose bool) error {
+	blocks, err := selectCode(answer, selection)
+	if err != nil {
+		return err
+	}
+
+	if selection.out == "" {
+		code := make([]string, len(blocks))
+		for i, block := range blocks {
+			code[i] = block.Code
+		}
+		return write(strings.Join(code, "\n\n"), os.Stdout, verbose)
+	}
+
+	for i, path := range codeFileNames(selection.out, blocks) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		mode := os.FileMode(0o644)
+		if strings.HasPrefix(blocks[i].Code, "#!") {
+			mode = 0o755
+		}
+		if err := os.WriteFile(path, []byte(blocks[i].Code+"\n"), mode); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+/**
+* This function returns the path every block is written to in dir: the file
+* name given by the answer when it stays inside dir, otherwise code-N with the
+* extension of the language. Names used twice, or of files already in dir, get
+* the number of the block, or the next free number when that name is taken too.
+ */
+func codeFileNames(dir string, blocks []markdown.CodeBlock) []string {
+	paths := make([]string, len(blocks))
+	used := map[string]bool{}
+	for i, block := range blocks {
+		name := filepath.FromSlash(block.FileName)
+		if name == "" || !filepath.IsLocal(name) {
+			name = fmt.Sprintf("code-%d.%s", i+1, markdown.Extension(block.Lang))
+		}
+		extension := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, extension)
+		for n := i + 1; used[name] || fileExists(filepath.Join(dir, name)); n++ {
+			name = fmt.Sprintf("%s-%d%s", stem, n, extension)
+		}
+		used[name] = true
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths
+}
+
+/**
+* This function adds the --code flags to a command asking questions
+ */
+func addCodeFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("code", false, "print only the code blocks of the answer")
+	cmd.Flags().String("code-lang", "", "print only the code blocks of this language, e.g. bash")
+	cmd.Flags().Int("code-index", 0, "print only the N-th code block, counting from 1")
+	cmd.Flags().String("code-out", "", "write every code block to a file in this directory, named after the file the answer gives or the language, numbered when the file exists")
+}
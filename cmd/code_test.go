@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/markdown"
+	"github.com/spf13/cobra"
+)
+
+func TestCodeFromFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		want    *codeSelection
+		wantErr bool
+	}{
+		{args: nil, want: nil},
+		{args: []string{"--code"}, want: &codeSelection{}},
+		{args: []string{"--code-lang", "bash"}, want: &codeSelection{lang: "bash"}},
+		{args: []string{"--code-index", "2"}, want: &codeSelection{index: 2}},
+		{args: []string{"--code-out", "out"}, want: &codeSelection{out: "out"}},
+		{args: []string{"--code-index", "0"}, wantErr: true},
+		{args: []string{"--code-index", "-1"}, wantErr: true},
+	} {
+		cmd := &cobra.Command{}
+		addCodeFlags(cmd)
+		if err := cmd.ParseFlags(tc.args); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := codeFromFlags(cmd)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected an error", tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tc.args, err)
+		} else if (got == nil) != (tc.want == nil) || got != nil && *got != *tc.want {
+			t.Errorf("%v: got %+v, want %+v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestSelectCode(t *testing.T) {
+	answer := "Run:\n\n```sh\nmake\n```\n\nThen:\n\n```python\nprint(1)\n```\n\n```bash\nmake test\n```\n"
+
+	for _, tc := range []struct {
+		selection codeSelection
+		want      string
+		wantErr   bool
+	}{
+		{selection: codeSelection{}, want: "make,print(1),make test"},
+		{selection: codeSelection{index: 2}, want: "print(1)"},
+		{selection: codeSelection{lang: "bash"}, want: "make,make test"},
+		{selection: codeSelection{lang: "SH", index: 2}, want: "make test"},
+		{selection: codeSelection{lang: "py"}, want: "print(1)"},
+		{selection: codeSelection{index: 4}, wantErr: true},
+		{selection: codeSelection{lang: "python", index: 2}, wantErr: true},
+		{selection: codeSelection{lang: "go"}, wantErr: true},
+	} {
+		blocks, err := selectCode(answer, tc.selection)
+		if tc.wantErr {
+			var notFound *codeNotFoundError
+			if !errors.As(err, &notFound) {
+				t.Errorf("%+v: got error %v, want a codeNotFoundError", tc.selection, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: unexpected error %v", tc.selection, err)
+			continue
+		}
+		var code []string
+		for _, block := range blocks {
+			code = append(code, block.Code)
+		}
+		if got := strings.Join(code, ","); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.selection, got, tc.want)
+		}
+	}
+}
+
+func TestCodeFileNames(t *testing.T) {
+	for name, tc := range map[string]struct {
+		blocks []markdown.CodeBlock
+		want   []string
+	}{
+		"languages": {
+			blocks: []markdown.CodeBlock{{Lang: "bash"}, {Lang: "python"}, {}},
+			want:   []string{"code-1.sh", "code-2.py", "code-3.txt"},
+		},
+		"answer names": {
+			blocks: []markdown.CodeBlock{{Lang: "go", FileName: "main.go"}, {Lang: "go", FileName: "pkg/util.go"}},
+			want:   []string{"main.go", "pkg/util.go"},
+		},
+		"outside the directory": {
+			blocks: []markdown.CodeBlock{{Lang: "sh", FileName: "../run.sh"}, {Lang: "sh", FileName: "/etc/run.sh"}},
+			want:   []string{"code-1.sh", "code-2.sh"},
+		},
+		"duplicates": {
+			blocks: []markdown.CodeBlock{{FileName: "main.go"}, {FileName: "main.go"}, {FileName: "main.go"}},
+			want:   []string{"main.go", "main-2.go", "main-3.go"},
+		},
+		"suffix taken by the answer": {
+			blocks: []markdown.CodeBlock{{Lang: "go", FileName: "code-2.go"}, {Lang: "go"}},
+			want:   []string{"code-2.go", "code-2-2.go"},
+		},
+		"suffix taken by a later name": {
+			blocks: []markdown.CodeBlock{{FileName: "app.py"}, {FileName: "app-3.py"}, {FileName: "app.py"}},
+			want:   []string{"app.py", "app-3.py", "app-4.py"},
+		},
+	} {
+		got := codeFileNames("out", tc.blocks)
+		for i := range tc.want {
+			tc.want[i] = filepath.Join("out", filepath.FromSlash(tc.want[i]))
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestCodeFileNamesKeepExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "main-2.go", "code-2.sh"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := codeFileNames(dir, []markdown.CodeBlock{{FileName: "main.go"}, {Lang: "sh"}, {FileName: "main.go"}})
+	want := []string{filepath.Join(dir, "main-1.go"), filepath.Join(dir, "code-2-2.sh"), filepath.Join(dir, "main-3.go")}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
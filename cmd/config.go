@@ -0,0 +1,484 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// configFileName is the name of the config file looked up in every layer.
+const configFileName = ".gq.yaml"
+
+// legacyConfigFileNames are also looked up, after configFileName, as older
+// releases accepted them. They are read as YAML, which JSON is a subset of.
+var legacyConfigFileNames = []string{".gq.yml", ".gq.json"}
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindFloat
+	kindInt
+	kindBool
+	kindStringList
+	kindStringMap
+)
+
+// setting describes a config key: its type, whether it is required, the
+// range of numeric values and the conventional environment variables, outside
+// the GQ_ namespace, that can provide it.
+type setting struct {
+	key      string
+	kind     settingKind
+	required bool
+	// min and max bound numeric settings. max is ignored when zero.
+	min float64
+	max float64
+	// choices lists the accepted values of a string setting, any value is accepted when empty.
+	choices []string
+	// models lists glob patterns of the known model names. Other names are
+	// only warned about, as providers release new models all the time.
+	models    []string
+	fallbacks []string
+}
+
+var (
+	temperatureSetting     = setting{key: "temperature", kind: kindFloat, max: 2}
+	maxOutputTokensSetting = setting{key: "maxOutputTokens", kind: kindInt, min: 1}
+	topPSetting            = setting{key: "topP", kind: kindFloat, max: 1}
+	// requestsPerMinuteSetting limits how many calls gq makes to a provider, see llm.RateLimiter.
+	requestsPerMinuteSetting = setting{key: "requestsPerMinute", kind: kindInt, min: 1}
+	// visionSetting tells whether the model accepts images when its name doesn't, see llm.requireVision.
+	visionSetting = setting{key: "vision", kind: kindBool}
+	// responseFormatSetting tells how --schema is sent to OpenAI-compatible servers, see llm.responseFormat.
+	responseFormatSetting = setting{key: "responseFormat", choices: []string{"jsonSchema", "jsonObject", "none"}}
+	// monthlyBudgetSetting caps the estimated spending on a provider, see checkBudget.
+	monthlyBudgetSetting = setting{key: "monthlyBudget", kind: kindFloat}
+)
+
+// providerSettings lists the settings of every provider section.
+var providerSettings = map[string][]setting{
+	"gemini": {
+		{key: "apiKey", required: true, fallbacks: []string{"GEMINI_API_KEY", "GOOGLE_API_KEY"}},
+		{key: "modelName", required: true, models: []string{"gemini-*", "gemma-*", "learnlm-*"}},
+		temperatureSetting,
+		maxOutputTokensSetting,
+		topPSetting,
+		requestsPerMinuteSetting,
+		visionSetting,
+		monthlyBudgetSetting,
+	},
+	"openAI": {
+		{key: "apiKey", required: true, fallbacks: []string{"OPENAI_API_KEY"}},
+		{key: "modelName", required: true, models: []string{"gpt-*", "chatgpt-*", "o[0-9]*", "ft:*"}},
+		{key: "baseURL", fallbacks: []string{"OPENAI_BASE_URL"}},
+		{key: "organization", fallbacks: []string{"OPENAI_ORG_ID"}},
+		{key: "headers", kind: kindStringMap},
+		{key: "imageModel"},
+		responseFormatSetting,
+		temperatureSetting,
+		maxOutputTokensSetting,
+		topPSetting,
+		requestsPerMinuteSetting,
+		visionSetting,
+		monthlyBudgetSetting,
+	},
+	"azureOpenAI": {
+		{key: "apiKey", required: true, fallbacks: []string{"AZURE_OPENAI_API_KEY"}},
+		{key: "modelDeploymentID", required: true},
+		{key: "modelEndpoint", required: true, fallbacks: []string{"AZURE_OPENAI_ENDPOINT"}},
+		{key: "imageDeploymentID"},
+		temperatureSetting,
+		maxOutputTokensSetting,
+		topPSetting,
+		requestsPerMinuteSetting,
+		visionSetting,
+		monthlyBudgetSetting,
+	},
+	"bedrock": {
+		// Model IDs are prefixed by their vendor, inference profiles by their region.
+		{key: "modelName", required: true, models: []string{
+			"amazon.*", "anthropic.*", "ai21.*", "cohere.*", "deepseek.*", "meta.*", "mistral.*", "writer.*",
+			"us.*", "eu.*", "apac.*", "us-gov.*", "arn:aws:bedrock:*",
+		}},
+		{key: "awsProfile", fallbacks: []string{"AWS_PROFILE"}},
+		{key: "awsRegion", fallbacks: []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+		{key: "temperature", kind: kindFloat, max: 1},
+		maxOutputTokensSetting,
+		topPSetting,
+		{key: "stopSequences", kind: kindStringList},
+		{key: "api", choices: []string{"converse", "invokeModel"}},
+		{key: "imageModel"},
+		requestsPerMinuteSetting,
+		visionSetting,
+		monthlyBudgetSetting,
+	},
+	"anthropic": {
+		{key: "apiKey", required: true, fallbacks: []string{"ANTHROPIC_API_KEY"}},
+		{key: "baseURL", fallbacks: []string{"ANTHROPIC_BASE_URL"}},
+		{key: "modelName", required: true, models: []string{"claude-*"}},
+		{key: "system"},
+		{key: "temperature", kind: kindFloat, max: 1},
+		maxOutputTokensSetting,
+		topPSetting,
+		{key: "stopSequences", kind: kindStringList},
+		requestsPerMinuteSetting,
+		visionSetting,
+		monthlyBudgetSetting,
+	},
+	"ollama": {
+		{key: "host", fallbacks: []string{"OLLAMA_HOST"}},
+		{key: "modelName", required: true},
+		temperatureSetting,
+		{key: "contextSize", kind: kindInt, min: 1},
+		maxOutputTokensSetting,
+		topPSetting,
+		requestsPerMinuteSetting,
+		visionSetting,
+		monthlyBudgetSetting,
+	},
+}
+
+// endpointSettings lists the settings of the OpenAI-compatible endpoints
+// defined under endpoints.<name>. Every endpoint is a provider of its own.
+var endpointSettings = []setting{
+	{key: "baseURL", required: true},
+	{key: "apiKey"},
+	{key: "modelName", required: true},
+	{key: "organization"},
+	{key: "headers", kind: kindStringMap},
+	{key: "imageModel"},
+	responseFormatSetting,
+	temperatureSetting,
+	maxOutputTokensSetting,
+	topPSetting,
+	requestsPerMinuteSetting,
+	visionSetting,
+	monthlyBudgetSetting,
+}
+
+// topLevelSettings lists the settings outside of any provider section.
+var topLevelSettings = []setting{
+	{key: "default"},
+	{key: "stream", kind: kindBool},
+	{key: "retry.maxAttempts", kind: kindInt, min: 1},
+	{key: "templates.dir"},
+	{key: "templates.strict", kind: kindBool},
+	{key: "files.maxSize", kind: kindInt, min: 1},
+	{key: "ledger.enabled", kind: kindBool},
+	{key: "budget.monthly", kind: kindFloat},
+	{key: "budget.action", choices: []string{"warn", "refuse"}},
+	{key: "render.enabled", kind: kindBool},
+	{key: "render.theme"},
+	{key: "render.width", kind: kindInt, min: 20},
+}
+
+/**
+* This function returns the names of the provider sections in a stable order
+ */
+func providerNames() []string {
+	names := make([]string, 0, len(providerSettings))
+	for name := range providerSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+* This function returns the names of the OpenAI-compatible endpoints defined in the config in a stable order
+ */
+func endpointNames() []string {
+	endpoints := viper.GetStringMap("endpoints")
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+* This function returns the names of the built-in providers followed by the endpoints
+ */
+func allProviderNames() []string {
+	return append(providerNames(), endpointNames()...)
+}
+
+/**
+* This function returns the config section holding the settings of a provider
+* or endpoint, and whether there is one
+ */
+func providerSection(name string) (string, bool) {
+	if _, ok := providerSettings[name]; ok {
+		return name, true
+	}
+	for _, endpoint := range endpointNames() {
+		if strings.EqualFold(endpoint, name) {
+			return "endpoints." + endpoint, true
+		}
+	}
+	return "", false
+}
+
+/**
+* This function binds every known setting to its environment variables.
+* GQ_<SECTION>_<KEY> always wins over the conventional fallbacks, e.g.
+* openAI.apiKey is read from GQ_OPENAI_API_KEY, then OPENAI_API_KEY.
+ */
+func bindEnv() {
+	for _, s := range topLevelSettings {
+		viper.BindEnv(append([]string{s.key, "GQ_" + envName(s.key)}, s.fallbacks...)...)
+	}
+	for section, settings := range providerSettings {
+		bindSectionEnv(section, settings)
+	}
+}
+
+/**
+* This function binds the settings of the endpoints found in the config files,
+* e.g. endpoints.groq.apiKey is read from GQ_ENDPOINTS_GROQ_API_KEY
+ */
+func bindEndpointEnv() {
+	for _, name := range endpointNames() {
+		bindSectionEnv("endpoints."+name, endpointSettings)
+	}
+}
+
+func bindSectionEnv(section string, settings []setting) {
+	for _, s := range settings {
+		key := section + "." + s.key
+		viper.BindEnv(append([]string{key, "GQ_" + envName(section) + "_" + envName(s.key)}, s.fallbacks...)...)
+	}
+}
+
+/**
+* This function turns a camelCase config key into an environment variable name,
+* e.g. maxOutputTokens becomes MAX_OUTPUT_TOKENS, openAI becomes OPENAI and
+* retry.maxAttempts becomes RETRY_MAX_ATTEMPTS
+ */
+func envName(key string) string {
+	if section, rest, nested := strings.Cut(key, "."); nested {
+		return envName(section) + "_" + envName(rest)
+	}
+	if section, ok := sectionEnvNames[key]; ok {
+		return section
+	}
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			r = '_'
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// sectionEnvNames holds the section names whose casing doesn't follow camelCase word boundaries.
+var sectionEnvNames = map[string]string{
+	"openAI":      "OPENAI",
+	"azureOpenAI": "AZURE_OPENAI",
+}
+
+// loadedConfigFiles lists the config files merged into viper, lowest precedence first.
+var loadedConfigFiles []string
+
+/**
+* This function loads the layered configuration. Layers are merged in this
+* order, each one overriding the keys of the previous ones:
+*   1. $XDG_CONFIG_HOME/gq/.gq.yaml (default $HOME/.config/gq/.gq.yaml)
+*   2. the nearest .gq.yaml found walking up from the current directory
+*   3. the file named by the GQ_CONFIG environment variable
+*   4. the file passed with --config
+* A missing layer is skipped, but a file named explicitly by GQ_CONFIG or
+* --config has to exist. Environment variables override every file, see bindEnv.
+ */
+func initConfig(cmd *cobra.Command) error {
+	explicit, _ := cmd.Flags().GetString("config")
+
+	layers, err := configLayers(explicit)
+	if err != nil {
+		return err
+	}
+
+	bindEnv()
+
+	viper.SetConfigType("yaml")
+	loadedConfigFiles = nil
+	for _, path := range layers {
+		if err := mergeConfigFile(path); err != nil {
+			return err
+		}
+		loadedConfigFiles = append(loadedConfigFiles, path)
+	}
+
+	bindEndpointEnv()
+
+	if len(loadedConfigFiles) > 0 {
+		// The most specific file is the one `viper.WriteConfig` would update.
+		viper.SetConfigFile(loadedConfigFiles[len(loadedConfigFiles)-1])
+	}
+
+	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+		if len(loadedConfigFiles) == 0 {
+			fmt.Println("\033[33mNo config file found\033[0m")
+		}
+		for _, path := range loadedConfigFiles {
+			fmt.Println("\033[33mUsing config file: \033[36m" + path + "\033[0m")
+		}
+	}
+	return nil
+}
+
+/**
+* This function returns the existing config files, lowest precedence first
+ */
+func configLayers(explicit string) ([]string, error) {
+	var layers []string
+	add := func(path string) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		for _, existing := range layers {
+			if existing == abs {
+				return
+			}
+		}
+		layers = append(layers, abs)
+	}
+
+	if global, err := globalConfigFile(); err == nil && fileExists(global) {
+		add(global)
+	}
+
+	if local, ok := findProjectConfig(); ok {
+		add(local)
+	}
+
+	for _, source := range []struct{ name, path string }{
+		{"GQ_CONFIG", os.Getenv("GQ_CONFIG")},
+		{"--config", explicit},
+	} {
+		if source.path == "" {
+			continue
+		}
+		if !fileExists(source.path) {
+			return nil, llm.ConfigError("", "config file %s given by %s does not exist", source.path, source.name)
+		}
+		add(source.path)
+	}
+
+	return layers, nil
+}
+
+/**
+* This function returns the path of the user-wide config file
+ */
+func globalConfigFile() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	dir := filepath.Join(configHome, "gq")
+	if path, ok := findConfigFile(dir); ok {
+		return path, nil
+	}
+	return filepath.Join(dir, configFileName), nil
+}
+
+/**
+* This function returns the config file of the directory, .gq.yaml or one of
+* the legacy names
+ */
+func findConfigFile(dir string) (string, bool) {
+	for _, name := range append([]string{configFileName}, legacyConfigFileNames...) {
+		if path := filepath.Join(dir, name); fileExists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+/**
+* This function walks up from the current directory looking for a project-local config file
+ */
+func findProjectConfig() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		if candidate, ok := findConfigFile(dir); ok {
+			return candidate, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func mergeConfigFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return &llm.Error{Kind: llm.ErrBadConfig, Message: "error reading config file " + path, Err: err}
+	}
+	defer f.Close()
+
+	if err := viper.MergeConfig(f); err != nil {
+		return &llm.Error{Kind: llm.ErrBadConfig, Message: "error reading config file " + path, Err: err}
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	return err == nil && !info.IsDir()
+}
+
+/**
+* This function returns the per-call generation options given on the command line.
+* Flags that were not set are left empty so the config values apply.
+ */
+func optionsFromFlags(cmd *cobra.Command) llm.Options {
+	flags := cmd.Flags()
+	var options llm.Options
+
+	options.Verbose, _ = flags.GetBool("verbose")
+	options.Model, _ = flags.GetString("model")
+	options.MaxTokens, _ = flags.GetInt("max-tokens")
+	if flags.Changed("temperature") {
+		temperature, _ := flags.GetFloat64("temperature")
+		options.Temperature = &temperature
+	}
+	if flags.Changed("top-p") {
+		topP, _ := flags.GetFloat64("top-p")
+		options.TopP = &topP
+	}
+	return options
+}
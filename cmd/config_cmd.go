@@ -0,0 +1,658 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/chzyer/readline"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// wizardDefaults holds the values suggested by `gq config init`.
+var wizardDefaults = map[string]string{
+	"gemini.modelName":            "gemini-2.5-flash",
+	"gemini.temperature":          "0.7",
+	"gemini.maxOutputTokens":      "1024",
+	"openAI.modelName":            "gpt-4.1-mini",
+	"openAI.temperature":          "0.5",
+	"openAI.maxOutputTokens":      "1024",
+	"azureOpenAI.temperature":     "0.5",
+	"azureOpenAI.maxOutputTokens": "1024",
+	"anthropic.modelName":         "claude-sonnet-4-5",
+	"anthropic.maxOutputTokens":   "1024",
+	"bedrock.modelName":           "us.anthropic.claude-haiku-4-5-20251001-v1:0",
+	"bedrock.awsRegion":           "us-east-1",
+	"ollama.host":                 llm.OLLAMA_DEFAULT_HOST,
+	"ollama.modelName":            "llama3",
+	"ollama.temperature":          "0.7",
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Create, inspect and validate the config file",
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a config file interactively",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, _ := cmd.Flags().GetString("file")
+		force, _ := cmd.Flags().GetBool("force")
+		if path == "" {
+			global, err := globalConfigFile()
+			if err != nil {
+				return err
+			}
+			path = global
+		}
+		return runConfigInit(path, force)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a setting, e.g. openAI.modelName",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value := viper.Get(args[0])
+		if value == nil {
+			return fmt.Errorf("%s is not set", args[0])
+		}
+		if section, ok := value.(map[string]any); ok {
+			out, err := yaml.Marshal(section)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(out))
+			return nil
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a value in the config file, e.g. gq config set openAI.temperature 0.2",
+	Long: `
+  Sets a value in the config file, keeping its comments and layout.
+
+  The most specific config file loaded is updated, or the user-wide one
+  ($HOME/.config/gq/.gq.yaml) when there is none. Use --file to pick another one.
+    `,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			path = viper.ConfigFileUsed()
+		}
+		if path == "" {
+			global, err := globalConfigFile()
+			if err != nil {
+				return err
+			}
+			path = global
+		}
+
+		if filepath.Ext(path) == ".json" {
+			return newUsageError("%s is a JSON file, gq config set only edits YAML. Rename it to %s to edit it", path, configFileName)
+		}
+
+		doc, err := readYAML(path)
+		if err != nil {
+			return err
+		}
+		if err := setYAMLValue(doc, args[0], args[1]); err != nil {
+			return err
+		}
+		if err := writeYAML(path, doc); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s in %s\n", args[0], path)
+		return nil
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the config files in use, lowest precedence first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(loadedConfigFiles) == 0 {
+			global, err := globalConfigFile()
+			if err != nil {
+				return err
+			}
+			fmt.Println(global + " (does not exist yet)")
+			return nil
+		}
+		for _, path := range loadedConfigFiles {
+			fmt.Println(path)
+		}
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config for missing keys, bad values and typos",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		problems, warnings := validateConfig()
+		printWarnings(warnings)
+		if len(problems) == 0 {
+			fmt.Println("\033[32mConfig is valid\033[0m")
+			return nil
+		}
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "\033[31m✗\033[0m "+problem)
+		}
+		return &configProblemsError{problems: problems}
+	},
+}
+
+// configProblemsError is returned by gq config validate when the config has problems.
+type configProblemsError struct {
+	problems []string
+}
+
+func (e *configProblemsError) Error() string {
+	return fmt.Sprintf("%d problem(s) found in the config", len(e.problems))
+}
+
+/**
+* This function checks the merged config, including environment overrides,
+* and returns every problem found, and warnings about the values that may be
+* wrong, e.g. unknown model names. Provider sections are only checked when
+* they are in the config files or selected as the default.
+ */
+func validateConfig() ([]string, []string) {
+	var problems, warnings []string
+	settings := viper.AllSettings()
+
+	knownTopLevel := map[string]bool{}
+	for _, s := range topLevelSettings {
+		section, _, _ := strings.Cut(s.key, ".")
+		knownTopLevel[strings.ToLower(section)] = true
+	}
+	for _, name := range providerNames() {
+		knownTopLevel[strings.ToLower(name)] = true
+	}
+	knownTopLevel["endpoints"] = true
+	knownTopLevel["personas"] = true
+	knownTopLevel["prices"] = true
+	for _, key := range sortedKeys(settings) {
+		if !knownTopLevel[key] {
+			problems = append(problems, fmt.Sprintf("unknown key %q", key))
+		}
+	}
+
+	for _, s := range topLevelSettings {
+		if problem := checkValue(s.key, s, viper.Get(s.key)); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	for _, name := range endpointNames() {
+		// Endpoint names are lowercased by viper, so compare the lowercased provider names.
+		if knownTopLevel[name] {
+			problems = append(problems, fmt.Sprintf("endpoints.%s: the name is already used by a built-in provider", name))
+		}
+	}
+
+	defaultProvider := viper.GetString("default")
+	defaultSection, ok := providerSection(defaultProvider)
+	if defaultProvider != "" && !ok {
+		problems = append(problems, fmt.Sprintf("default: unknown provider %q. Use one of %s", defaultProvider, strings.Join(allProviderNames(), ", ")))
+	}
+
+	for _, name := range personaNames() {
+		problems = append(problems, validatePersona(name)...)
+	}
+	problems = append(problems, validatePrices()...)
+
+	sections := map[string][]setting{}
+	for name, s := range providerSettings {
+		sections[name] = s
+	}
+	for _, name := range endpointNames() {
+		sections["endpoints."+name] = endpointSettings
+	}
+
+	for _, name := range sortedKeys(sections) {
+		if name != defaultSection && !sectionConfigured(name) {
+			continue
+		}
+
+		known := map[string]bool{}
+		for _, s := range sections[name] {
+			known[strings.ToLower(s.key)] = true
+			key := name + "." + s.key
+
+			if !viper.IsSet(key) {
+				if s.required {
+					problems = append(problems, fmt.Sprintf("%s is required (or set %s)", key, strings.Join(envNames(name, s), " or ")))
+				}
+				continue
+			}
+			if problem := checkValue(key, s, viper.Get(key)); problem != "" {
+				problems = append(problems, problem)
+			}
+			if warning := checkModel(key, s, viper.GetString(key)); warning != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+
+		for _, key := range sortedKeys(viper.GetStringMap(name)) {
+			if !known[key] {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %q", name, key))
+			}
+		}
+	}
+
+	return problems, warnings
+}
+
+/**
+* This function returns a warning when the model name matches none of the
+* known ones, e.g. a typo or a retired model. It returns an empty string when
+* the name is known or the setting lists no models.
+ */
+func checkModel(key string, s setting, model string) string {
+	if len(s.models) == 0 || model == "" {
+		return ""
+	}
+	for _, pattern := range s.models {
+		// Unlike path.Match, * also matches the slashes of inference profile ARNs.
+		expr := strings.NewReplacer(`\*`, ".*", `\[`, "[", `\]`, "]").Replace(regexp.QuoteMeta(pattern))
+		if regexp.MustCompile("^" + expr + "$").MatchString(model) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s: unknown model %q, check its name. Known models look like %s", key, model, strings.Join(s.models, ", "))
+}
+
+/**
+* This function checks the settings of the persona defined under personas.<name>
+ */
+func validatePersona(name string) []string {
+	var problems []string
+	section := "personas." + name
+
+	known := map[string]bool{}
+	for _, s := range personaSettings {
+		known[strings.ToLower(s.key)] = true
+		if problem := checkValue(section+"."+s.key, s, viper.Get(section+"."+s.key)); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	for _, key := range sortedKeys(viper.GetStringMap(section)) {
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("%s: unknown key %q", section, key))
+		}
+	}
+
+	if provider := viper.GetString(section + ".provider"); provider != "" {
+		if _, ok := providerSection(provider); !ok {
+			problems = append(problems, fmt.Sprintf("%s.provider: unknown provider %q. Use one of %s", section, provider, strings.Join(allProviderNames(), ", ")))
+		}
+	}
+	return problems
+}
+
+/**
+* This function checks the entries of the prices list
+ */
+func validatePrices() []string {
+	value := viper.Get("prices")
+	if value == nil {
+		return nil
+	}
+	entries, ok := value.([]any)
+	if !ok {
+		return []string{"prices must be a list of provider, model, prompt and completion entries"}
+	}
+
+	var problems []string
+	for i, entry := range entries {
+		key := fmt.Sprintf("prices[%d]", i)
+		fields, err := cast.ToStringMapE(entry)
+		if err != nil {
+			problems = append(problems, key+" must be a mapping with provider, model, prompt and completion")
+			continue
+		}
+
+		known := map[string]bool{}
+		for _, s := range priceSettings {
+			known[s.key] = true
+			value, set := fields[s.key]
+			if !set {
+				if s.required {
+					problems = append(problems, fmt.Sprintf("%s.%s is required", key, s.key))
+				}
+				continue
+			}
+			if problem := checkValue(key+"."+s.key, s, value); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+		for _, name := range sortedKeys(fields) {
+			if !known[name] {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %q", key, name))
+			}
+		}
+
+		if provider, ok := fields["provider"].(string); ok && provider != "" {
+			if _, ok := providerSection(provider); !ok {
+				problems = append(problems, fmt.Sprintf("%s.provider: unknown provider %q. Use one of %s", key, provider, strings.Join(allProviderNames(), ", ")))
+			}
+		}
+		if pattern, ok := fields["model"].(string); ok {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.model: invalid pattern %q", key, pattern))
+			}
+		}
+	}
+	return problems
+}
+
+/**
+* This function checks the type and range of a single value. It returns an
+* empty string when the value is fine.
+ */
+func checkValue(key string, s setting, value any) string {
+	if value == nil {
+		return ""
+	}
+
+	switch s.kind {
+	case kindString:
+		if len(s.choices) > 0 && !slices.Contains(s.choices, fmt.Sprint(value)) {
+			return fmt.Sprintf("%s must be one of %s, got %q", key, strings.Join(s.choices, ", "), fmt.Sprint(value))
+		}
+		return ""
+	case kindBool:
+		if _, err := cast.ToBoolE(value); err != nil {
+			return fmt.Sprintf("%s must be true or false, got %q", key, fmt.Sprint(value))
+		}
+		return ""
+	case kindStringList:
+		if _, err := cast.ToStringSliceE(value); err != nil {
+			return fmt.Sprintf("%s must be a list of strings, got %q", key, fmt.Sprint(value))
+		}
+		return ""
+	case kindStringMap:
+		if _, err := cast.ToStringMapStringE(value); err != nil {
+			return fmt.Sprintf("%s must be a mapping of names to values, got %q", key, fmt.Sprint(value))
+		}
+		return ""
+	case kindFloat, kindInt:
+		number, err := cast.ToFloat64E(value)
+		if err != nil {
+			return fmt.Sprintf("%s must be a number, got %q", key, fmt.Sprint(value))
+		}
+		if s.kind == kindInt && number != math.Trunc(number) {
+			return fmt.Sprintf("%s must be a whole number, got %v", key, number)
+		}
+		if s.max != 0 && (number < s.min || number > s.max) {
+			return fmt.Sprintf("%s must be between %v and %v, got %v", key, s.min, s.max, number)
+		}
+		if number < s.min {
+			return fmt.Sprintf("%s must be at least %v, got %v", key, s.min, number)
+		}
+	}
+	return ""
+}
+
+/**
+* This function reports whether the section is in the config files. The
+* environment doesn't count: variables like ANTHROPIC_API_KEY or AWS_REGION
+* are often set for other tools, and don't mean the provider is used with gq.
+ */
+func sectionConfigured(name string) bool {
+	return viper.InConfig(name)
+}
+
+func envNames(section string, s setting) []string {
+	return append([]string{"GQ_" + envName(section) + "_" + envName(s.key)}, s.fallbacks...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/**
+* This function asks for the settings of one or more providers and writes a
+* new config file readable only by the user.
+ */
+func runConfigInit(path string, force bool) error {
+	if fileExists(path) && !force {
+		return fmt.Errorf("%s already exists. Use --force to overwrite it or gq config set to change it", path)
+	}
+
+	rl, err := readline.New("")
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	ask := func(prompt string, suggestion string) (string, error) {
+		if suggestion != "" {
+			prompt += " [" + suggestion + "]"
+		}
+		rl.SetPrompt(prompt + ": ")
+		line, err := rl.Readline()
+		if err != nil {
+			return "", err
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return suggestion, nil
+		}
+		return line, nil
+	}
+	askProvider := func(prompt string, suggestion string) (string, error) {
+		for {
+			name, err := ask(prompt+" ("+strings.Join(providerNames(), ", ")+")", suggestion)
+			if err != nil {
+				return "", err
+			}
+			if _, ok := providerSettings[name]; ok {
+				return name, nil
+			}
+			fmt.Printf("\033[31mUnknown provider %q\033[0m\n", name)
+		}
+	}
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+
+	provider, err := askProvider("Default provider", "gemini")
+	if err != nil {
+		return err
+	}
+	if err := setYAMLValue(doc, "default", provider); err != nil {
+		return err
+	}
+
+	for {
+		fmt.Printf("\033[33mConfiguring %s. Leave optional settings empty to skip them.\033[0m\n", provider)
+		for _, s := range providerSettings[provider] {
+			key := provider + "." + s.key
+			label := s.key
+			if !s.required {
+				label += " (optional)"
+			}
+
+			for {
+				var value string
+				if s.key == "apiKey" {
+					secret, err := rl.ReadPassword(label + ": ")
+					if err != nil {
+						return err
+					}
+					value = strings.TrimSpace(string(secret))
+				} else if value, err = ask(label, wizardDefaults[key]); err != nil {
+					return err
+				}
+
+				if value == "" {
+					if s.required {
+						fmt.Printf("\033[31m%s is required\033[0m\n", s.key)
+						continue
+					}
+					break
+				}
+
+				var parsed any
+				yaml.Unmarshal([]byte(value), &parsed)
+				if problem := checkValue(key, s, parsed); problem != "" {
+					fmt.Println("\033[31m" + problem + "\033[0m")
+					continue
+				}
+				if err := setYAMLValue(doc, key, value); err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		another, err := ask("Configure another provider? (y/N)", "n")
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(strings.ToLower(another), "y") {
+			break
+		}
+		if provider, err = askProvider("Provider", ""); err != nil {
+			return err
+		}
+	}
+
+	if err := writeYAML(path, doc); err != nil {
+		return err
+	}
+	fmt.Printf("\033[32mWrote %s\033[0m\n", path)
+	return nil
+}
+
+/**
+* This function reads a YAML file as a node tree so it can be edited without
+* losing comments. A missing file yields an empty document.
+ */
+func readYAML(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, nil
+	}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s is not a YAML mapping", path)
+	}
+	return doc, nil
+}
+
+/**
+* This function sets a dotted key, e.g. openAI.temperature, creating the
+* sections on the way. Existing keys are matched case-insensitively like viper does.
+ */
+func setYAMLValue(doc *yaml.Node, key string, value string) error {
+	node := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		last := i == len(parts)-1
+
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if strings.EqualFold(node.Content[j].Value, part) {
+				child = node.Content[j+1]
+				break
+			}
+		}
+
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, child)
+		}
+
+		if last {
+			// A flow sequence such as ["a", "b"] sets a list.
+			var list yaml.Node
+			if strings.HasPrefix(value, "[") && yaml.Unmarshal([]byte(value), &list) == nil && list.Content[0].Kind == yaml.SequenceNode {
+				*child = *list.Content[0]
+				return nil
+			}
+			child.Kind = yaml.ScalarNode
+			child.Tag = ""
+			child.Value = value
+			child.Content = nil
+			child.Style = 0
+			if value == "" {
+				child.Style = yaml.DoubleQuotedStyle
+			}
+			return nil
+		}
+		if child.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a section", strings.Join(parts[:i+1], "."))
+		}
+		node = child
+	}
+	return nil
+}
+
+func writeYAML(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file, and the file holds API keys.
+	return os.Chmod(path, 0o600)
+}
+
+func init() {
+	configInitCmd.Flags().String("file", "", "file to create (default $HOME/.config/gq/.gq.yaml)")
+	configInitCmd.Flags().Bool("force", false, "overwrite an existing file")
+	configSetCmd.Flags().String("file", "", "file to update")
+
+	configCmd.AddCommand(configInitCmd, configGetCmd, configSetCmd, configPathCmd, configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+/**
+* This function loads the config file the way gq does, isolated from the
+* config files and state of the machine running the tests
+ */
+func loadTestConfig(t *testing.T, config string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	t.Setenv("GQ_CONFIG", "")
+	chdir(t, dir)
+
+	path := filepath.Join(dir, "test.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", path, "")
+	if err := initConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateConfigIgnoresFallbackEnvironment(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	loadTestConfig(t, "default: gemini\ngemini:\n  apiKey: key\n  modelName: gemini-1.5-flash\n")
+
+	if problems, _ := validateConfig(); len(problems) != 0 {
+		t.Errorf("a gemini-only config was flagged: %v", problems)
+	}
+}
+
+func TestValidateConfigChecksConfiguredSections(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	loadTestConfig(t, "default: gemini\ngemini:\n  apiKey: key\nanthropic:\n  temperature: 3\n")
+
+	found, _ := validateConfig()
+	problems := strings.Join(found, "\n")
+	if !strings.Contains(problems, "anthropic.modelName is required") || !strings.Contains(problems, "anthropic.temperature") {
+		t.Errorf("the anthropic section of the config file was not checked: %s", problems)
+	}
+	if strings.Contains(problems, "anthropic.apiKey") {
+		t.Errorf("the anthropic API key from the environment was ignored: %s", problems)
+	}
+
+	// The hint names what to fix instead of the command that just failed.
+	_, hint := describeError(&configProblemsError{problems: found})
+	if strings.Contains(hint, "config validate") || !strings.Contains(hint, "gq config init") {
+		t.Errorf("unexpected hint %q", hint)
+	}
+	if code := exitCode(&configProblemsError{problems: found}); code != exitBadConfig {
+		t.Errorf("got exit code %d, want %d", code, exitBadConfig)
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	for name, tc := range map[string]struct {
+		// files maps the layers, global, project, GQ_CONFIG and --config, to the
+		// name of their file, relative to the config directory, the project or the test directory.
+		files map[string]string
+		want  string
+	}{
+		"none":                {files: map[string]string{}, want: ""},
+		"global":              {files: map[string]string{"global": ".gq.yaml"}, want: "global"},
+		"project over global": {files: map[string]string{"global": ".gq.yaml", "project": ".gq.yaml"}, want: "project"},
+		"GQ_CONFIG over project": {
+			files: map[string]string{"global": ".gq.yaml", "project": ".gq.yaml", "GQ_CONFIG": "env.yaml"},
+			want:  "GQ_CONFIG",
+		},
+		"--config over GQ_CONFIG": {
+			files: map[string]string{"global": ".gq.yaml", "project": ".gq.yaml", "GQ_CONFIG": "env.yaml", "--config": "flag.yaml"},
+			want:  "--config",
+		},
+		"--config over project": {files: map[string]string{"project": ".gq.yaml", "--config": "flag.yaml"}, want: "--config"},
+		"legacy global":         {files: map[string]string{"global": ".gq.yml"}, want: "global"},
+		"legacy project":        {files: map[string]string{"global": ".gq.yaml", "project": ".gq.json"}, want: "project"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			configHome := filepath.Join(dir, "config")
+			project := filepath.Join(dir, "project")
+			// The project file is found walking up from a nested directory.
+			wd := filepath.Join(project, "src", "pkg")
+			if err := os.MkdirAll(wd, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("XDG_CONFIG_HOME", configHome)
+			t.Setenv("GQ_CONFIG", "")
+			chdir(t, wd)
+
+			explicit := ""
+			for layer, file := range tc.files {
+				var path string
+				switch layer {
+				case "global":
+					path = filepath.Join(configHome, "gq", file)
+				case "project":
+					path = filepath.Join(project, file)
+				case "GQ_CONFIG":
+					path = filepath.Join(dir, file)
+					t.Setenv("GQ_CONFIG", path)
+				case "--config":
+					path = filepath.Join(dir, file)
+					explicit = path
+				}
+				content := "layer: " + layer + "\n" + layer + ": true\n"
+				if strings.HasSuffix(file, ".json") {
+					content = `{"layer": "` + layer + `", "` + layer + `": true}`
+				}
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			cmd := &cobra.Command{}
+			cmd.Flags().String("config", explicit, "")
+			if err := initConfig(cmd); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := viper.GetString("layer"); got != tc.want {
+				t.Errorf("got the layer setting of %q, want %q", got, tc.want)
+			}
+			// The keys of the lower layers are kept.
+			for layer := range tc.files {
+				if !viper.GetBool(layer) {
+					t.Errorf("the %s layer was not merged", layer)
+				}
+			}
+			if len(loadedConfigFiles) != len(tc.files) {
+				t.Errorf("got the files %v, want %d of them", loadedConfigFiles, len(tc.files))
+			}
+		})
+	}
+}
+
+func TestConfigLayersMissingExplicitFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	chdir(t, dir)
+
+	t.Setenv("GQ_CONFIG", filepath.Join(dir, "missing.yaml"))
+	if _, err := configLayers(""); err == nil || !strings.Contains(err.Error(), "GQ_CONFIG") {
+		t.Errorf("got error %v, want one naming GQ_CONFIG", err)
+	}
+	t.Setenv("GQ_CONFIG", "")
+	if _, err := configLayers(filepath.Join(dir, "missing.yaml")); err == nil || !strings.Contains(err.Error(), "--config") {
+		t.Errorf("got error %v, want one naming --config", err)
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok := findConfigFile(dir); ok {
+		t.Error("found a config file in an empty directory")
+	}
+	for _, name := range []string{".gq.json", ".gq.yml", ".gq.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// .gq.yaml wins over .gq.yml, which wins over .gq.json.
+		if got, ok := findConfigFile(dir); !ok || filepath.Base(got) != name {
+			t.Errorf("got %s, want %s", got, name)
+		}
+	}
+}
+
+func TestFindProjectConfigStopsAtTheRoot(t *testing.T) {
+	// No config file is expected above the temporary directory, so the walk
+	// goes up to the filesystem root and stops there.
+	chdir(t, t.TempDir())
+	if path, ok := findProjectConfig(); ok {
+		t.Errorf("found %s above the temporary directory", path)
+	}
+}
+
+/**
+* This function changes the working directory for the duration of the test
+ */
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestValidateConfigWarnsAboutUnknownModels(t *testing.T) {
+	loadTestConfig(t, "default: gemini\ngemini:\n  apiKey: key\n  modelName: gemni-2.5-flash\nanthropic:\n  apiKey: key\n  modelName: claude-sonnet-4-5\nollama:\n  modelName: whatever\n")
+
+	problems, warnings := validateConfig()
+	if len(problems) != 0 {
+		t.Errorf("an unknown model is not an error: %v", problems)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `gemini.modelName: unknown model "gemni-2.5-flash"`) {
+		t.Errorf("got warnings %v, want one about gemini.modelName", warnings)
+	}
+}
+
+func TestCheckModel(t *testing.T) {
+	for model, known := range map[string]bool{
+		"anthropic.claude-3-haiku-20240307-v1:0":                                    true,
+		"us.anthropic.claude-haiku-4-5-20251001-v1:0":                               true,
+		"arn:aws:bedrock:us-east-1:123:inference-profile/us.meta.llama3-2-90b-v1:0": true,
+		"claude-sonnet-4-5": false,
+		"":                  true,
+	} {
+		s := providerSettings["bedrock"][0]
+		if got := checkModel("bedrock.modelName", s, model) == ""; got != known {
+			t.Errorf("%s: got known %v, want %v", model, got, known)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/spf13/viper"
+)
+
+// price is an entry of the prices list of the config file. Prices are in
+// dollars per 1K tokens. Model can be a glob, e.g. gpt-4o*, and the first
+// matching entry wins.
+type price struct {
+	Provider   string  `mapstructure:"provider"`
+	Model      string  `mapstructure:"model"`
+	Prompt     float64 `mapstructure:"prompt"`
+	Completion float64 `mapstructure:"completion"`
+}
+
+// priceSettings lists the settings of every entry of the prices list.
+var priceSettings = []setting{
+	{key: "provider"},
+	{key: "model", required: true},
+	{key: "prompt", kind: kindFloat},
+	{key: "completion", kind: kindFloat},
+}
+
+// usageReport is the token usage of a call and its estimated cost, printed by --usage.
+type usageReport struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+	llm.Usage
+	// EstimatedCost is in dollars, unset when no price matches the model.
+	EstimatedCost *float64 `json:"estimatedCost,omitempty"`
+}
+
+/**
+* This function returns the model a call uses: the one given with -m or the
+* persona, otherwise the model of the provider section
+ */
+func modelName(provider string, options llm.Options) string {
+	if options.Model != "" {
+		return options.Model
+	}
+	section, _ := providerSection(provider)
+	if provider == "azureOpenAI" {
+		return viper.GetString(section + ".modelDeploymentID")
+	}
+	return viper.GetString(section + ".modelName")
+}
+
+/**
+* This function returns the prices list of the config file
+ */
+func prices() ([]price, error) {
+	var list []price
+	if err := viper.UnmarshalKey("prices", &list); err != nil {
+		return nil, llm.ConfigError("", "prices must be a list of provider, model, prompt and completion entries: %v", err)
+	}
+	return list, nil
+}
+
+/**
+* This function returns the price of the model, and false when the prices
+* list has no entry for it
+ */
+func priceOf(list []price, provider string, model string) (price, bool) {
+	for _, p := range list {
+		if p.Provider != "" && !strings.EqualFold(p.Provider, provider) {
+			continue
+		}
+		if matched, _ := path.Match(p.Model, model); matched || p.Model == model {
+			return p, true
+		}
+	}
+	return price{}, false
+}
+
+/**
+* This function returns the usage report of a call, with its cost estimated
+* from the prices list when the model has a price
+ */
+func newUsageReport(provider string, model string, usage llm.Usage) (usageReport, error) {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	report := usageReport{Provider: provider, Model: model, Usage: usage}
+
+	list, err := prices()
+	if err != nil {
+		return report, err
+	}
+	if p, ok := priceOf(list, provider, model); ok {
+		cost := (float64(usage.PromptTokens)*p.Prompt + float64(usage.CompletionTokens)*p.Completion) / 1000
+		report.EstimatedCost = &cost
+	}
+	return report, nil
+}
+
+/**
+* This function prints the usage report to w, as a summary line or, when
+* format is json, as a JSON object on a single line
+ */
+func printUsage(w io.Writer, format string, report usageReport) error {
+	if format == "json" {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	line := fmt.Sprintf("%s %s: %d prompt + %d completion = %d tokens",
+		report.Provider, report.Model, report.PromptTokens, report.CompletionTokens, report.TotalTokens)
+	if report.TotalTokens == 0 {
+		line = fmt.Sprintf("%s %s: the provider didn't report the token usage", report.Provider, report.Model)
+	} else if report.EstimatedCost != nil {
+		line += fmt.Sprintf(", ~$%.6f", *report.EstimatedCost)
+	} else {
+		line += ", no price set for the model"
+	}
+	_, err := fmt.Fprintln(w, "\033[33m"+line+"\033[0m")
+	return err
+}
+
+/**
+* This function prints the usage of a call to stderr when --usage is set
+ */
+func reportUsage(format string, provider string, options llm.Options, usage llm.Usage) error {
+	if format == "" {
+		return nil
+	}
+	report, err := newUsageReport(provider, modelName(provider, options), usage)
+	if err != nil {
+		return err
+	}
+	return printUsage(os.Stderr, format, report)
+}
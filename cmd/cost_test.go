@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestPriceOf(t *testing.T) {
+	list := []price{
+		{Provider: "openAI", Model: "gpt-4o-mini", Prompt: 1},
+		{Model: "gpt-4o*", Prompt: 2},
+		{Model: "claude-3-5-*", Prompt: 3},
+		{Model: "claude-3-5-sonnet-20240620", Prompt: 4},
+		{Provider: "azureOpenAI", Model: "*", Prompt: 5},
+		{Model: "[invalid", Prompt: 6},
+	}
+
+	for name, tc := range map[string]struct {
+		provider string
+		model    string
+		want     float64
+		found    bool
+	}{
+		"exact model":                  {provider: "openAI", model: "gpt-4o-mini", want: 1, found: true},
+		"provider is case insensitive": {provider: "OPENAI", model: "gpt-4o-mini", want: 1, found: true},
+		"other provider skips entry":   {provider: "endpoint", model: "gpt-4o-mini", want: 2, found: true},
+		"glob":                         {provider: "openAI", model: "gpt-4o-2024-08-06", want: 2, found: true},
+		"glob listed first wins":       {provider: "anthropic", model: "claude-3-5-sonnet-20240620", want: 3, found: true},
+		"provider-wide glob":           {provider: "azureOpenAI", model: "my-deployment", want: 5, found: true},
+		"invalid glob matches exactly": {provider: "ollama", model: "[invalid", want: 6, found: true},
+		"no price":                     {provider: "ollama", model: "llama3.2", found: false},
+		"glob doesn't cross slashes":   {provider: "endpoint", model: "openai/gpt-4o", found: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, found := priceOf(list, tc.provider, tc.model)
+			if found != tc.found || got.Prompt != tc.want {
+				t.Errorf("priceOf(%q, %q) = %v, %v, want the price %v, %v", tc.provider, tc.model, got.Prompt, found, tc.want, tc.found)
+			}
+		})
+	}
+}
+
+func TestNewUsageReport(t *testing.T) {
+	loadTestConfig(t, `
+prices:
+  - provider: openAI
+    model: gpt-4o-mini
+    prompt: 0.00015
+    completion: 0.0006
+`)
+
+	report, err := newUsageReport("openAI", "gpt-4o-mini", llm.Usage{PromptTokens: 2000, CompletionTokens: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalTokens != 2500 {
+		t.Errorf("TotalTokens = %d, want the sum of the prompt and completion tokens", report.TotalTokens)
+	}
+	// 2K prompt tokens at $0.00015 and 0.5K completion tokens at $0.0006.
+	if report.EstimatedCost == nil || math.Abs(*report.EstimatedCost-0.0006) > 1e-12 {
+		t.Errorf("EstimatedCost = %v, want 0.0006", report.EstimatedCost)
+	}
+
+	report, err = newUsageReport("ollama", "llama3.2", llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.EstimatedCost != nil {
+		t.Errorf("EstimatedCost = %v, want none for a model without a price", *report.EstimatedCost)
+	}
+	var out bytes.Buffer
+	if err := printUsage(&out, "", report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "10 prompt + 5 completion = 15 tokens, no price set for the model") {
+		t.Errorf("got %q", out.String())
+	}
+
+	viper.Set("prices", "cheap")
+	if _, err := newUsageReport("openAI", "gpt-4o-mini", llm.Usage{}); llm.KindOf(err) != llm.ErrBadConfig {
+		t.Errorf("got error %v, want a config error for prices that are not a list", err)
+	}
+}
+
+func TestProjectPricesOverrideGlobalPrices(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("GQ_CONFIG", "")
+	chdir(t, dir)
+
+	for path, content := range map[string]string{
+		filepath.Join(dir, "config", "gq", ".gq.yaml"): "prices:\n  - model: gpt-4o*\n    prompt: 1\n    completion: 1\n",
+		filepath.Join(dir, ".gq.yaml"):                 "prices:\n  - model: gpt-4o-mini\n    prompt: 0.5\n    completion: 2\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", "", "")
+	if err := initConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := newUsageReport("openAI", "gpt-4o-mini", llm.Usage{PromptTokens: 1000, CompletionTokens: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.EstimatedCost == nil || *report.EstimatedCost != 2.5 {
+		t.Errorf("EstimatedCost = %v, want 2.5 from the project prices", report.EstimatedCost)
+	}
+	// The project list replaces the global one rather than adding to it.
+	report, err = newUsageReport("openAI", "gpt-4o", llm.Usage{PromptTokens: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.EstimatedCost != nil {
+		t.Errorf("EstimatedCost = %v, want none once the project prices replace the global ones", *report.EstimatedCost)
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+)
+
+// Exit codes of gq. They are documented in the README, scripts rely on them.
+const (
+	exitOK              = 0
+	exitError           = 1
+	exitUsage           = 2
+	exitBadConfig       = 3
+	exitAuth            = 4
+	exitRateLimit       = 5
+	exitQuota           = 6
+	exitModelNotFound   = 7
+	exitContentFiltered = 8
+	exitNetwork         = 9
+	exitTimeout         = 10
+	exitNoCode          = 11
+)
+
+var exitCodes = map[llm.ErrorKind]int{
+	llm.ErrUnknown:         exitError,
+	llm.ErrBadConfig:       exitBadConfig,
+	llm.ErrAuth:            exitAuth,
+	llm.ErrRateLimit:       exitRateLimit,
+	llm.ErrQuota:           exitQuota,
+	llm.ErrModelNotFound:   exitModelNotFound,
+	llm.ErrContentFiltered: exitContentFiltered,
+	llm.ErrNetwork:         exitNetwork,
+	llm.ErrTimeout:         exitTimeout,
+}
+
+// errorHints tells the user what to try next for every kind of failure.
+var errorHints = map[llm.ErrorKind]string{
+	llm.ErrBadConfig:       "Run gq config validate to check the config, or gq config init to create one",
+	llm.ErrAuth:            "Check the API key or credentials of the provider",
+	llm.ErrRateLimit:       "Wait a moment and try again",
+	llm.ErrQuota:           "Check the usage limits and billing of the provider account",
+	llm.ErrModelNotFound:   "Check the modelName of the provider or pass another one with --model",
+	llm.ErrContentFiltered: "Rephrase the question",
+	llm.ErrNetwork:         "Check the network connection and the endpoint of the provider",
+	llm.ErrTimeout:         "Try again, or ask for a shorter answer with --max-tokens",
+}
+
+// usageError is returned when gq is called with invalid arguments or flags.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func newUsageError(format string, args ...any) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+/**
+* This function returns the exit code for an error returned by a command
+ */
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var usage *usageError
+	if errors.As(err, &usage) {
+		return exitUsage
+	}
+	var noCode *codeNotFoundError
+	if errors.As(err, &noCode) {
+		return exitNoCode
+	}
+	var problems *configProblemsError
+	if errors.As(err, &problems) {
+		return exitBadConfig
+	}
+	if errors.Is(err, context.Canceled) {
+		return exitError
+	}
+	return exitCodes[llm.KindOf(err)]
+}
+
+/**
+* This function returns the message and, when there is one, the hint shown for an error
+ */
+func describeError(err error) (string, string) {
+	var usage *usageError
+	if errors.As(err, &usage) {
+		return usage.Error(), "Run gq --help for usage"
+	}
+	var noCode *codeNotFoundError
+	if errors.As(err, &noCode) {
+		return noCode.Error(), "Ask for the code explicitly, or run again without the --code flags to see the whole answer"
+	}
+	var problems *configProblemsError
+	if errors.As(err, &problems) {
+		return problems.Error(), "Fix the keys listed above with gq config set <key> <value>, or create a new config with gq config init"
+	}
+	return err.Error(), errorHints[llm.KindOf(err)]
+}
+
+/**
+* This function writes a friendly description of err to w and returns the exit code to use
+ */
+func renderError(w io.Writer, err error) int {
+	message, hint := describeError(err)
+	fmt.Fprintln(w, "\033[31mError: "+message+"\033[0m")
+	if hint != "" {
+		fmt.Fprintln(w, "\033[33m"+hint+"\033[0m")
+	}
+	return exitCode(err)
+}
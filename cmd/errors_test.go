@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/spf13/viper"
+)
+
+// TestExitCodeFromHTTPStatus follows a failure from the HTTP status of the
+// provider to the exit code scripts see, documented in the README.
+func TestExitCodeFromHTTPStatus(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			json.NewEncoder(w).Encode(map[string]any{"models": []any{}})
+			return
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(status)})
+	}))
+	defer server.Close()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("ollama.host", server.URL)
+	viper.Set("ollama.modelName", "llama3")
+
+	for _, tc := range []struct {
+		status int
+		kind   llm.ErrorKind
+		code   int
+	}{
+		{status: http.StatusBadRequest, kind: llm.ErrUnknown, code: exitError},
+		{status: http.StatusUnauthorized, kind: llm.ErrAuth, code: exitAuth},
+		{status: http.StatusForbidden, kind: llm.ErrAuth, code: exitAuth},
+		{status: http.StatusNotFound, kind: llm.ErrModelNotFound, code: exitModelNotFound},
+		{status: http.StatusRequestTimeout, kind: llm.ErrTimeout, code: exitTimeout},
+		{status: http.StatusTooManyRequests, kind: llm.ErrRateLimit, code: exitRateLimit},
+		{status: http.StatusInternalServerError, kind: llm.ErrNetwork, code: exitNetwork},
+		{status: http.StatusServiceUnavailable, kind: llm.ErrNetwork, code: exitNetwork},
+		{status: http.StatusGatewayTimeout, kind: llm.ErrTimeout, code: exitTimeout},
+	} {
+		status = tc.status
+		_, err := llm.OllamaProvider{}.Chat(context.Background(), llm.NewChatRequest("Hi", llm.Options{}))
+		if kind := llm.KindOf(err); kind != tc.kind {
+			t.Errorf("status %d: got %s, want %s (%v)", tc.status, kind, tc.kind, err)
+		}
+		if code := exitCode(err); code != tc.code {
+			t.Errorf("status %d: got exit code %d, want %d", tc.status, code, tc.code)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{err: nil, want: 0},
+		{err: errors.New("boom"), want: 1},
+		{err: context.Canceled, want: 1},
+		{err: newUsageError("no question provided"), want: 2},
+		{err: llm.ConfigError("", "no provider selected"), want: 3},
+		{err: &configProblemsError{problems: []string{"default: unknown provider"}}, want: 3},
+		{err: &llm.Error{Kind: llm.ErrAuth}, want: 4},
+		{err: &llm.Error{Kind: llm.ErrRateLimit}, want: 5},
+		{err: &llm.Error{Kind: llm.ErrQuota}, want: 6},
+		{err: &llm.Error{Kind: llm.ErrModelNotFound}, want: 7},
+		{err: &llm.Error{Kind: llm.ErrContentFiltered}, want: 8},
+		{err: &llm.Error{Kind: llm.ErrNetwork}, want: 9},
+		{err: &llm.Error{Kind: llm.ErrTimeout}, want: 10},
+		{err: &codeNotFoundError{message: "the answer holds no code block"}, want: 11},
+		{err: fmt.Errorf("asking: %w", &llm.Error{Kind: llm.ErrQuota}), want: 6},
+	} {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("%v: got exit code %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestEveryErrorKindHasAnExitCodeAndHint(t *testing.T) {
+	for kind := llm.ErrUnknown; kind <= llm.ErrBadConfig; kind++ {
+		if _, ok := exitCodes[kind]; !ok {
+			t.Errorf("%s has no exit code", kind)
+		}
+		if _, hint := describeError(&llm.Error{Kind: kind}); hint == "" && kind != llm.ErrUnknown {
+			t.Errorf("%s has no hint", kind)
+		}
+	}
+}
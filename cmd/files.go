@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/avinashsivaraman/gq/cmd/attach"
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+/**
+* This function reads the files given with -f and returns the text files as
+* delimited sections, along with the images. Every skipped file is reported on stderr.
+ */
+func attachFiles(cmd *cobra.Command, patterns []string) (string, []llm.Image, error) {
+	if len(patterns) == 0 {
+		return "", nil, nil
+	}
+
+	maxSize := viper.GetInt64("files.maxSize")
+	if cmd.Flags().Changed("max-file-size") {
+		maxSize, _ = cmd.Flags().GetInt64("max-file-size")
+	}
+
+	files, warnings, err := attach.Collect(patterns, attach.Options{MaxSize: maxSize})
+	if err != nil {
+		return "", nil, newUsageError("%s", err)
+	}
+	printWarnings(warnings)
+
+	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+		fmt.Println("\033[33mAttaching files: \033[0m")
+		for _, f := range files {
+			fmt.Printf("\033[36m%s (%d bytes)\033[0m\n", f.Path, len(f.Content))
+		}
+	}
+	return attach.Format(files), images(files), nil
+}
+
+/**
+* This function returns the images among the attached files
+ */
+func images(files []attach.File) []llm.Image {
+	var images []llm.Image
+	for _, f := range files {
+		if f.MIMEType != "" {
+			images = append(images, llm.Image{MIMEType: f.MIMEType, Data: f.Content})
+		}
+	}
+	return images
+}
+
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "\033[33mWarning: "+warning+"\033[0m")
+	}
+}
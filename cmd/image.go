@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image <prompt>",
+	Short: "Generate images from a prompt",
+	Long: `
+  Generates images with openAI (DALL·E, gpt-image), azureOpenAI, bedrock (Titan Image,
+  Nova Canvas, Stability AI) or an OpenAI-compatible endpoint, and writes them to files.
+  The model is the imageModel of the provider (imageDeploymentID for azureOpenAI) unless -m is given.
+
+  Usage examples:
+    - Write a single image to image.png:
+        gq image -p openAI "a lighthouse at dawn, watercolor"
+
+    - Write four images to out/ as image-1.png to image-4.png:
+        gq image -p bedrock -n 4 --size 1024x1024 --out out/ "a lighthouse at dawn"
+
+    - Reproduce an image on Bedrock with the same seed:
+        gq image -p bedrock --seed 42 --cfg-scale 8 --negative-prompt "people" "a lighthouse"
+    `,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		verbose, _ := flags.GetBool("verbose")
+
+		prompt := strings.Join(args, " ")
+		if prompt == "" && isInputFromPipe() {
+			piped, err := readFromPipe(os.Stdin)
+			if err != nil {
+				return err
+			}
+			prompt = strings.TrimSpace(piped)
+		}
+		if prompt == "" {
+			return newUsageError("no prompt given. Use gq image \"<prompt>\"")
+		}
+
+		req := llm.ImageRequest{Prompt: prompt, Verbose: verbose}
+		req.Model, _ = flags.GetString("model")
+		req.NegativePrompt, _ = flags.GetString("negative-prompt")
+		req.N, _ = flags.GetInt("n")
+		req.Size, _ = flags.GetString("size")
+		req.Quality, _ = flags.GetString("quality")
+		if req.N < 1 {
+			return newUsageError("-n must be at least 1")
+		}
+		if flags.Changed("cfg-scale") {
+			cfgScale, _ := flags.GetFloat64("cfg-scale")
+			req.CfgScale = &cfgScale
+		}
+		if flags.Changed("seed") {
+			seed, _ := flags.GetInt64("seed")
+			req.Seed = &seed
+		}
+
+		provider, _ := flags.GetString("provider")
+		if provider == "" {
+			provider = viper.GetString("default")
+			if provider == "" {
+				return llm.ConfigError("", "no provider selected. Use -p or set default in the config file")
+			}
+		}
+		if verbose {
+			fmt.Println("\033[33mUsing Image Provider: \033[0m")
+			fmt.Println("\033[36m" + provider)
+			fmt.Println("\033[0m")
+		}
+
+		chatProvider, err := newChatProvider(provider)
+		if err != nil {
+			return err
+		}
+		imageProvider, ok := chatProvider.(llm.ImageProvider)
+		if !ok {
+			return llm.ConfigError(provider, "this provider doesn't generate images. Use openAI, azureOpenAI, bedrock or an OpenAI-compatible endpoint")
+		}
+
+		if err := checkBudget(provider); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		images, err := imageProvider.GenerateImages(context.Background(), req)
+		recordCall(provider, imageModelName(provider, req.Model), start, llm.Usage{}, len(images), err)
+		if err != nil {
+			return err
+		}
+
+		out, _ := flags.GetString("out")
+		for i, image := range images {
+			path := imagePath(out, i, len(images), image)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return fmt.Errorf("writing the image: %w", err)
+			}
+			if err := os.WriteFile(path, image.Data, 0o644); err != nil {
+				return fmt.Errorf("writing the image: %w", err)
+			}
+			fmt.Println(path)
+			if verbose && image.RevisedPrompt != "" {
+				fmt.Println("\033[33mRevised prompt: \033[0m")
+				fmt.Println("\033[36m" + image.RevisedPrompt + "\033[0m")
+			}
+		}
+		return nil
+	},
+}
+
+/**
+* This function returns the image model a call uses, for the usage ledger
+ */
+func imageModelName(provider string, model string) string {
+	if model != "" {
+		return model
+	}
+	section, _ := providerSection(provider)
+	switch {
+	case provider == "azureOpenAI":
+		return viper.GetString(section + ".imageDeploymentID")
+	case viper.IsSet(section + ".imageModel"):
+		return viper.GetString(section + ".imageModel")
+	case provider == "bedrock":
+		return llm.TITAN_IMAGE_MODEL_ID
+	}
+	return openai.CreateImageModelDallE3
+}
+
+/**
+* This function returns the path of the i-th of count images. Without out, or
+* when out is a directory, the images are named image in it. Several images
+* are numbered, e.g. out-1.png, out-2.png. A path without extension gets the
+* one of the image type. An existing file is never overwritten: the name gets
+* the next free number instead, e.g. image-1.png when image.png exists.
+ */
+func imagePath(out string, i int, count int, image llm.GeneratedImage) string {
+	if out == "" {
+		out = "image"
+	} else if info, err := os.Stat(out); (err == nil && info.IsDir()) || strings.HasSuffix(out, "/") || strings.HasSuffix(out, string(filepath.Separator)) {
+		out = filepath.Join(out, "image")
+	}
+	ext := filepath.Ext(out)
+	base := strings.TrimSuffix(out, ext)
+	if ext == "" {
+		ext = image.Extension()
+	}
+	if count > 1 {
+		base = fmt.Sprintf("%s-%d", base, i+1)
+	}
+	path := base + ext
+	for n := 1; fileExists(path); n++ {
+		path = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	return path
+}
+
+func init() {
+	imageCmd.Flags().StringP("out", "o", "", "file or directory to write the images to, numbered when there are several or the file exists (default image.png, or the extension of the image type)")
+	imageCmd.Flags().IntP("n", "n", 1, "number of images to generate")
+	imageCmd.Flags().String("size", "", "size of the images as WIDTHxHEIGHT, e.g. 1024x1024")
+	imageCmd.Flags().String("quality", "", "quality of the images, e.g. standard or hd for DALL·E 3, standard or premium for Titan")
+	imageCmd.Flags().Float64("cfg-scale", 0, "how strictly the images follow the prompt (Bedrock only)")
+	imageCmd.Flags().Int64("seed", 0, "seed making the generation reproducible (Bedrock only)")
+	imageCmd.Flags().String("negative-prompt", "", "what the images must not show (Bedrock only)")
+
+	rootCmd.AddCommand(imageCmd)
+}
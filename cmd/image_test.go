@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+)
+
+func TestImagePath(t *testing.T) {
+	dir := t.TempDir()
+	png := llm.GeneratedImage{Image: llm.Image{MIMEType: "image/png"}}
+	jpeg := llm.GeneratedImage{Image: llm.Image{MIMEType: "image/jpeg"}}
+	for _, name := range []string{"image.png", "image-1.png", "fox-2.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		out   string
+		i     int
+		count int
+		image llm.GeneratedImage
+		want  string
+	}{
+		{out: "", count: 1, image: png, want: "image.png"},
+		{out: "", count: 1, image: jpeg, want: "image.jpg"},
+		{out: "", i: 1, count: 2, image: jpeg, want: "image-2.jpg"},
+		{out: "fox.png", count: 1, image: jpeg, want: "fox.png"},
+		{out: "fox", count: 1, image: jpeg, want: "fox.jpg"},
+		{out: "out/", i: 0, count: 2, image: png, want: filepath.Join("out", "image-1.png")},
+		{out: dir, count: 1, image: jpeg, want: filepath.Join(dir, "image.jpg")},
+		{out: dir, count: 1, image: png, want: filepath.Join(dir, "image-2.png")},
+		{out: filepath.Join(dir, "fox"), i: 1, count: 2, image: png, want: filepath.Join(dir, "fox-2-1.png")},
+	} {
+		if got := imagePath(tc.out, tc.i, tc.count, tc.image); got != tc.want {
+			t.Errorf("imagePath(%q, %d, %d, %s) = %q, want %q", tc.out, tc.i, tc.count, tc.image.MIMEType, got, tc.want)
+		}
+	}
+}
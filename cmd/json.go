@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/spf13/cobra"
+)
+
+// jsonEnvelope is the output of --json.
+type jsonEnvelope struct {
+	// Answer is the text of the answer, or the JSON value with --schema.
+	Answer       any       `json:"answer"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model,omitempty"`
+	FinishReason string    `json:"finishReason,omitempty"`
+	Usage        jsonUsage `json:"usage"`
+	// Attempts is the number of calls made to get an answer matching the schema.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+type jsonUsage struct {
+	llm.Usage
+	EstimatedCost *float64 `json:"estimatedCost,omitempty"`
+}
+
+// schemaNameChars are the characters OpenAI accepts in schema names.
+var schemaNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+/**
+* This function reads and compiles the JSON Schema file given with --schema
+ */
+func loadSchema(path string) (*llm.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newUsageError("reading the schema: %s", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = strings.Trim(schemaNameChars.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		name = "answer"
+	}
+	schema, err := llm.NewSchema(name, data)
+	if err != nil {
+		return nil, newUsageError("%s: %s", path, err)
+	}
+	return schema, nil
+}
+
+/**
+* This function asks the question for a JSON answer and prints it, wrapped in
+* the envelope of --json when set. With --schema the answer is validated and
+* the question asked again with the validation errors, up to --schema-retries times.
+ */
+func answerJSON(provider string, settings callSettings, request llm.ChatRequest) (llm.ChatResponse, error) {
+	var answer llm.ChatResponse
+	var usage llm.Usage
+	var value any = ""
+	attempts := 0
+
+	if settings.schema != nil {
+		request.Schema = settings.schema
+		request.Messages = withSystemPrompt(settings.schema.Instruction(), request.Messages)
+	}
+	for {
+		attempts++
+		response, err := askQuestion(request, provider)
+		if err != nil {
+			return llm.ChatResponse{}, err
+		}
+		answer = response
+		usage.PromptTokens += response.Usage.PromptTokens
+		usage.CompletionTokens += response.Usage.CompletionTokens
+		usage.TotalTokens += response.Usage.TotalTokens
+
+		if settings.schema == nil {
+			value = response.Text
+			break
+		}
+		value, err = settings.schema.Validate(response.Text)
+		if err == nil {
+			break
+		}
+		if attempts > settings.schemaRetries {
+			return llm.ChatResponse{}, fmt.Errorf("%w (after %d attempt(s))", err, attempts)
+		}
+		if settings.options.Verbose {
+			fmt.Printf("\033[33mRetrying, %s\033[0m\n", err)
+		}
+		request.Messages = append(append([]llm.Message{}, request.Messages...),
+			llm.Message{Role: llm.RoleAssistant, Content: response.Text},
+			llm.Message{Role: llm.RoleUser, Content: "Invalid answer, " + err.Error() + ". Answer again with only the corrected JSON."},
+		)
+	}
+	answer.Usage = usage
+
+	var output any = value
+	if settings.jsonOutput {
+		model := modelName(provider, settings.options)
+		report, err := newUsageReport(provider, model, usage)
+		if err != nil {
+			return llm.ChatResponse{}, err
+		}
+		envelope := jsonEnvelope{
+			Answer:       value,
+			Provider:     provider,
+			Model:        model,
+			FinishReason: answer.FinishReason,
+			Usage:        jsonUsage{Usage: report.Usage, EstimatedCost: report.EstimatedCost},
+		}
+		if settings.schema != nil {
+			envelope.Attempts = attempts
+		}
+		output = envelope
+	}
+
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return llm.ChatResponse{}, err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return answer, err
+}
+
+/**
+* This function adds the --json and --schema flags to a command asking questions
+ */
+func addJSONFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("json", false, "print the answer, provider, model, usage and finish reason as a JSON object")
+	cmd.Flags().String("schema", "", "JSON Schema file the answer must match, the answer is printed as JSON")
+	cmd.Flags().Int("schema-retries", 2, "how many times to ask again when the answer doesn't match the schema")
+}
@@ -0,0 +1,186 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileName is the name of the ledger file in the state directory of gq.
+const FileName = "usage.jsonl"
+
+// Entry is a call recorded in the ledger.
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model,omitempty"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	TotalTokens      int       `json:"totalTokens"`
+	// Images is the number of images generated by the call, if any.
+	Images int `json:"images,omitempty"`
+	// Cost is the estimated cost in dollars, unset when the model has no price.
+	Cost      *float64 `json:"cost,omitempty"`
+	LatencyMS int64    `json:"latencyMs"`
+	Success   bool     `json:"success"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Ledger is an append-only file holding one JSON entry per line.
+type Ledger struct {
+	Path string
+}
+
+// Append records an entry. Every entry is written with a single write to a
+// file opened in append mode, so concurrent gq processes don't mix their lines.
+func (l *Ledger) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries returns the entries recorded from from, included, to to, excluded.
+// A zero time leaves that end of the range open. Lines that can't be decoded,
+// e.g. cut short by a crash, are skipped.
+func (l *Ledger) Entries(from time.Time, to time.Time) ([]Entry, error) {
+	f, err := os.Open(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if (!from.IsZero() && entry.Time.Before(from)) || (!to.IsZero() && !entry.Time.Before(to)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the usage ledger: %w", err)
+	}
+	return entries, nil
+}
+
+// Spent returns the estimated cost of the entries, only counting the ones of
+// the provider when it is not empty.
+func Spent(entries []Entry, provider string) float64 {
+	var total float64
+	for _, entry := range entries {
+		if entry.Cost != nil && (provider == "" || strings.EqualFold(entry.Provider, provider)) {
+			total += *entry.Cost
+		}
+	}
+	return total
+}
+
+// Dimensions are the values Summarize can group entries by.
+var Dimensions = []string{"day", "month", "provider", "model"}
+
+// Group sums up the entries sharing the same values of the grouping dimensions.
+type Group struct {
+	Keys             []string `json:"keys"`
+	Calls            int      `json:"calls"`
+	Failed           int      `json:"failed"`
+	PromptTokens     int      `json:"promptTokens"`
+	CompletionTokens int      `json:"completionTokens"`
+	TotalTokens      int      `json:"totalTokens"`
+	Images           int      `json:"images,omitempty"`
+	Cost             float64  `json:"cost"`
+	// Unpriced counts the calls whose model had no price, left out of Cost.
+	Unpriced         int   `json:"unpriced,omitempty"`
+	AverageLatencyMS int64 `json:"averageLatencyMs"`
+
+	latency int64
+}
+
+// Summarize groups the entries by the dimensions, e.g. day and provider, in
+// the order of the keys. Times are grouped in the location of loc.
+func Summarize(entries []Entry, by []string, loc *time.Location) ([]Group, error) {
+	for _, dimension := range by {
+		if !slices.Contains(Dimensions, dimension) {
+			return nil, fmt.Errorf("unknown grouping %q. Use %s", dimension, strings.Join(Dimensions, ", "))
+		}
+	}
+
+	groups := map[string]*Group{}
+	for _, entry := range entries {
+		keys := make([]string, len(by))
+		for i, dimension := range by {
+			keys[i] = key(entry, dimension, loc)
+		}
+		id := strings.Join(keys, "\x00")
+		group, ok := groups[id]
+		if !ok {
+			group = &Group{Keys: keys}
+			groups[id] = group
+		}
+
+		group.Calls++
+		if !entry.Success {
+			group.Failed++
+		}
+		group.PromptTokens += entry.PromptTokens
+		group.CompletionTokens += entry.CompletionTokens
+		group.TotalTokens += entry.TotalTokens
+		group.Images += entry.Images
+		if entry.Cost != nil {
+			group.Cost += *entry.Cost
+		} else if entry.Success {
+			group.Unpriced++
+		}
+		group.latency += entry.LatencyMS
+	}
+
+	summary := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		group.AverageLatencyMS = group.latency / int64(group.Calls)
+		summary = append(summary, *group)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return strings.Join(summary[i].Keys, "\x00") < strings.Join(summary[j].Keys, "\x00")
+	})
+	return summary, nil
+}
+
+func key(entry Entry, dimension string, loc *time.Location) string {
+	switch dimension {
+	case "day":
+		return entry.Time.In(loc).Format("2006-01-02")
+	case "month":
+		return entry.Time.In(loc).Format("2006-01")
+	case "provider":
+		return entry.Provider
+	}
+	return entry.Model
+}
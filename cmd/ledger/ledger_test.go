@@ -0,0 +1,90 @@
+package ledger
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func cost(dollars float64) *float64 {
+	return &dollars
+}
+
+func TestAppendEntries(t *testing.T) {
+	l := &Ledger{Path: filepath.Join(t.TempDir(), "state", FileName)}
+
+	entries, err := l.Entries(time.Time{}, time.Time{})
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("empty ledger: got %v, %v", entries, err)
+	}
+
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entry := Entry{Time: day.AddDate(0, 0, i%4), Provider: "openAI", Model: "gpt-4o", TotalTokens: 10, Success: true}
+			if err := l.Append(entry); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// A line cut short by a crash is skipped.
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2024-05-02T`)
+	f.Close()
+
+	entries, err = l.Entries(time.Time{}, time.Time{})
+	if err != nil || len(entries) != 20 {
+		t.Fatalf("got %d entries, %v", len(entries), err)
+	}
+
+	entries, err = l.Entries(day.AddDate(0, 0, 1), day.AddDate(0, 0, 3))
+	if err != nil || len(entries) != 10 {
+		t.Fatalf("range: got %d entries, %v", len(entries), err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: day, Provider: "openAI", Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, Cost: cost(0.5), LatencyMS: 100, Success: true},
+		{Time: day.Add(time.Minute), Provider: "openAI", Model: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: cost(0.25), LatencyMS: 300, Success: true},
+		{Time: day.Add(time.Hour), Provider: "ollama", Model: "llama3", TotalTokens: 40, LatencyMS: 50, Success: true},
+		{Time: day.Add(time.Hour), Provider: "openAI", Model: "gpt-4o", LatencyMS: 20, Error: "rate limited"},
+	}
+
+	groups, err := Summarize(entries, []string{"day", "provider"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups: %+v", len(groups), groups)
+	}
+	first := groups[0]
+	if first.Keys[0] != "2024-05-01" || first.Keys[1] != "openAI" || first.Calls != 2 || first.TotalTokens != 165 || first.Cost != 0.75 || first.AverageLatencyMS != 200 {
+		t.Errorf("unexpected group %+v", first)
+	}
+	if groups[1].Keys[0] != "2024-05-02" || groups[1].Keys[1] != "ollama" || groups[1].Unpriced != 1 {
+		t.Errorf("unexpected group %+v", groups[1])
+	}
+	if groups[2].Failed != 1 || groups[2].Unpriced != 0 {
+		t.Errorf("unexpected group %+v", groups[2])
+	}
+
+	if spent := Spent(entries, "openai"); spent != 0.75 {
+		t.Errorf("spent %v, want 0.75", spent)
+	}
+
+	if _, err := Summarize(entries, []string{"week"}, time.UTC); err == nil {
+		t.Error("expected an error for an unknown grouping")
+	}
+}
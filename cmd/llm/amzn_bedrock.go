@@ -4,346 +4,759 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
-	"github.com/spf13/viper"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 )
 
-const (
-	CLAUDE_MODEL_ID             = "anthropic.claude-v2"
-	JURASSIC2_MODEL_ID          = "ai21.j2-mid-v1"
-	LLAMA2_MODEL_ID             = "meta.llama2-13b-chat-v1"
-	TITAN_IMAGE_MODEL_ID        = "amazon.titan-image-generator-v1"
-	TITAN_TEXT_EXPRESS_MODEL_ID = "amazon.titan-text-express-v1"
-)
+// TITAN_IMAGE_MODEL_ID is the image model used when bedrock.imageModel is not set.
+const TITAN_IMAGE_MODEL_ID = "amazon.titan-image-generator-v1"
 
 type AmznBedrockAIProvider struct{}
 
-func (_ AmznBedrockAIProvider) Chat(userQuery string, verbose bool) (string, error) {
-	amznBedrock := viper.Sub("bedrock")
+func (_ AmznBedrockAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	amznBedrock := Config("bedrock")
+
+	modelName := req.Options.model(amznBedrock.GetString("modelName"))
+	if err := requireSetting("bedrock", "modelName", modelName); err != nil {
+		return ChatResponse{}, err
+	}
+	if err := requireVision("bedrock", "bedrock", modelName, req); err != nil {
+		return ChatResponse{}, err
+	}
 
-	modelName := amznBedrock.GetString("modelName")
-	awsProfile := amznBedrock.GetString("awsProfile")
-	awsRegion := amznBedrock.GetString("awsRegion")
+	if imageModel(modelName) {
+		return ChatResponse{}, ConfigError("bedrock", "%s generates images. Use gq image, or a text model for questions", modelName)
+	}
 
-	// Load the Shared AWS Configuration (~/.aws/config)
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithSharedConfigProfile(awsProfile),
-		config.WithRegion(awsRegion))
+	client, err := newBedrockClient(ctx)
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
+		return ChatResponse{}, err
+	}
+
+	inferenceConfig := &types.InferenceConfiguration{}
+	if maxOutputTokens := req.Options.maxTokens(amznBedrock.GetInt("maxOutputTokens")); maxOutputTokens > 0 {
+		inferenceConfig.MaxTokens = aws.Int32(int32(maxOutputTokens))
+	}
+	if req.Options.Temperature != nil || amznBedrock.IsSet("temperature") {
+		inferenceConfig.Temperature = aws.Float32(float32(req.Options.temperature(amznBedrock.GetFloat64("temperature"))))
+	}
+	if req.Options.TopP != nil || amznBedrock.IsSet("topP") {
+		inferenceConfig.TopP = aws.Float32(float32(req.Options.topP(amznBedrock.GetFloat64("topP"))))
+	}
+	inferenceConfig.StopSequences = amznBedrock.GetStringSlice("stopSequences")
+
+	if req.Options.Verbose {
+		fmt.Println("\033[33mModel Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", modelName)
+		if inferenceConfig.Temperature != nil {
+			fmt.Println("Temperature: ", *inferenceConfig.Temperature)
+		}
+		if inferenceConfig.MaxTokens != nil {
+			fmt.Println("Max Output Tokens: ", *inferenceConfig.MaxTokens)
+		}
+		if inferenceConfig.TopP != nil {
+			fmt.Println("Top P: ", *inferenceConfig.TopP)
+		}
+		if len(inferenceConfig.StopSequences) > 0 {
+			fmt.Println("Stop Sequences: ", inferenceConfig.StopSequences)
+		}
+		fmt.Println("\033[0m")
 	}
-	// Create a new Bedrock Runtime client
-	client := bedrockruntime.NewFromConfig(cfg)
-	wrapper := InvokeModelWrapper{BedrockRuntimeClient: client}
 
-	switch modelName {
-	case CLAUDE_MODEL_ID:
-		return wrapper.InvokeClaude(userQuery)
-	case JURASSIC2_MODEL_ID:
-		return wrapper.InvokeJurassic2(userQuery)
-	case LLAMA2_MODEL_ID:
-		return wrapper.InvokeLlama2(userQuery)
-	case TITAN_IMAGE_MODEL_ID:
-		return wrapper.InvokeTitanImage(userQuery, 0)
-	case TITAN_TEXT_EXPRESS_MODEL_ID:
-		return wrapper.InvokeTitanText(userQuery)
+	switch api := amznBedrock.GetString("api"); api {
+	case "", "converse":
+	case "invokeModel":
+		if !strings.Contains(modelName, "anthropic.claude") {
+			return ChatResponse{}, ConfigError("bedrock", "bedrock.api invokeModel only supports Anthropic Claude models. Use converse for %q", modelName)
+		}
+		wrapper := InvokeModelWrapper{BedrockRuntimeClient: client}
+		return wrapper.InvokeClaude(ctx, modelName, claudeMessagesRequest(req, inferenceConfig), req.Stream)
 	default:
-		return "", fmt.Errorf("modelID %s not found", modelName)
+		return ChatResponse{}, ConfigError("bedrock", "unknown bedrock.api %q. Use converse or invokeModel", api)
 	}
-}
 
-// InvokeModelWrapper encapsulates Amazon Bedrock actions used in the examples.
-// It contains a Bedrock Runtime client that is used to invoke foundation models.
-type InvokeModelWrapper struct {
-	BedrockRuntimeClient *bedrockruntime.Client
-}
+	messages, system := converseMessages(req)
+	// Converse has no structured output setting, but a model made to call a
+	// tool answers with the tool input, which matches its schema.
+	var toolConfig *types.ToolConfiguration
+	if req.Schema != nil && req.Schema.object() && req.Stream == nil {
+		toolConfig = converseSchemaTool(req.Schema)
+	}
+	if req.Stream != nil {
+		return converseStream(ctx, client, &bedrockruntime.ConverseStreamInput{
+			ModelId:         aws.String(modelName),
+			Messages:        messages,
+			System:          system,
+			InferenceConfig: inferenceConfig,
+		}, req.Stream)
+	}
 
-// Each model provider has their own individual request and response formats.
-// For the format, ranges, and default values for Anthropic Claude, refer to:
-// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-claude.html
+	output, err := client.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId:         aws.String(modelName),
+		Messages:        messages,
+		System:          system,
+		InferenceConfig: inferenceConfig,
+		ToolConfig:      toolConfig,
+	})
+	if err != nil {
+		return ChatResponse{}, ProcessError(err, modelName)
+	}
 
-type ClaudeRequest struct {
-	Prompt            string   `json:"prompt"`
-	MaxTokensToSample int      `json:"max_tokens_to_sample"`
-	Temperature       float64  `json:"temperature,omitempty"`
-	StopSequences     []string `json:"stop_sequences,omitempty"`
-}
+	message, ok := output.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return ChatResponse{}, &Error{Provider: "bedrock", Message: "the model returned no message"}
+	}
+	var text strings.Builder
+	var toolInput []byte
+	for _, block := range message.Value.Content {
+		switch block := block.(type) {
+		case *types.ContentBlockMemberText:
+			text.WriteString(block.Value)
+		case *types.ContentBlockMemberToolUse:
+			input, err := block.Value.Input.MarshalSmithyDocument()
+			if err != nil {
+				return ChatResponse{}, &Error{Provider: "bedrock", Message: "the model returned an invalid tool input", Err: err}
+			}
+			toolInput = input
+		}
+	}
+	// The tool input is the answer, any text is the model thinking out loud.
+	answer := text.String()
+	if toolInput != nil {
+		answer = string(toolInput)
+	}
 
-type ClaudeResponse struct {
-	Completion string `json:"completion"`
+	return ChatResponse{
+		Text:         answer,
+		FinishReason: string(output.StopReason),
+		Usage:        converseUsage(output.Usage),
+	}, nil
 }
 
-// Invokes Anthropic Claude on Amazon Bedrock to run an inference using the input
-// provided in the request body.
-func (wrapper InvokeModelWrapper) InvokeClaude(prompt string) (string, error) {
-	modelId := "anthropic.claude-v2"
+// converseSchemaTool returns a tool taking the schema as input, which the model
+// must call.
+func converseSchemaTool(schema *Schema) *types.ToolConfiguration {
+	return &types.ToolConfiguration{
+		Tools: []types.Tool{&types.ToolMemberToolSpec{Value: types.ToolSpecification{
+			Name:        aws.String("answer"),
+			Description: aws.String("Give the answer in the structure of the input schema"),
+			InputSchema: &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(schema.decoded())},
+		}}},
+		ToolChoice: &types.ToolChoiceMemberAny{},
+	}
+}
 
-	// Anthropic Claude requires enclosing the prompt as follows:
-	enclosedPrompt := "Human: " + prompt + "\n\nAssistant:"
+// newBedrockClient returns a Bedrock Runtime client for the profile and region
+// of the bedrock section.
+func newBedrockClient(ctx context.Context) (*bedrockruntime.Client, error) {
+	amznBedrock := Config("bedrock")
 
-	body, err := json.Marshal(ClaudeRequest{
-		Prompt:            enclosedPrompt,
-		MaxTokensToSample: 200,
-		Temperature:       0.5,
-		StopSequences:     []string{"\n\nHuman:"},
-	})
+	// Load the Shared AWS Configuration (~/.aws/config). Settings left empty
+	// fall through to the standard AWS environment and credential chain.
+	// Retries are made by the retry layer of gq, see retry.go.
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithRetryer(func() aws.Retryer { return aws.NopRetryer{} }),
+	}
+	if awsProfile := amznBedrock.GetString("awsProfile"); awsProfile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(awsProfile))
+	}
+	if awsRegion := amznBedrock.GetString("awsRegion"); awsRegion != "" {
+		loadOptions = append(loadOptions, config.WithRegion(awsRegion))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
 	if err != nil {
-		log.Fatal("failed to marshal", err)
+		return nil, &Error{Kind: ErrBadConfig, Provider: "bedrock", Message: "unable to load the AWS SDK config", Err: err}
 	}
+	return bedrockruntime.NewFromConfig(cfg), nil
+}
 
-	output, err := wrapper.BedrockRuntimeClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String(modelId),
-		ContentType: aws.String("application/json"),
-		Body:        body,
-	})
+// converseMessages maps the conversation onto Converse messages and system
+// prompts. Converse requires the roles to alternate, so consecutive messages
+// of the same role are merged into one message with several content blocks.
+func converseMessages(req ChatRequest) ([]types.Message, []types.SystemContentBlock) {
+	var system []types.SystemContentBlock
+	if prompt := req.SystemPrompt(); prompt != "" {
+		system = append(system, &types.SystemContentBlockMemberText{Value: prompt})
+	}
+
+	var messages []types.Message
+	for _, m := range req.Turns() {
+		role := types.ConversationRoleUser
+		if m.Role == RoleAssistant {
+			role = types.ConversationRoleAssistant
+		}
+		var blocks []types.ContentBlock
+		for _, image := range m.Images {
+			blocks = append(blocks, &types.ContentBlockMemberImage{Value: types.ImageBlock{
+				Format: types.ImageFormat(image.format()),
+				Source: &types.ImageSourceMemberBytes{Value: image.Data},
+			}})
+		}
+		blocks = append(blocks, &types.ContentBlockMemberText{Value: m.Content})
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == role {
+			messages[last].Content = append(messages[last].Content, blocks...)
+			continue
+		}
+		messages = append(messages, types.Message{Role: role, Content: blocks})
+	}
+	return messages, system
+}
+
+// converseStream calls ConverseStream and hands every chunk of generated text
+// to onChunk as it arrives.
+func converseStream(ctx context.Context, client *bedrockruntime.Client, input *bedrockruntime.ConverseStreamInput, onChunk StreamFunc) (ChatResponse, error) {
+	output, err := client.ConverseStream(ctx, input)
 	if err != nil {
-		ProcessError(err, modelId)
+		return ChatResponse{}, ProcessError(err, aws.ToString(input.ModelId))
 	}
 
-	var response ClaudeResponse
-	if err := json.Unmarshal(output.Body, &response); err != nil {
-		log.Fatal("failed to unmarshal", err)
+	stream := output.GetStream()
+	defer stream.Close()
+
+	var response ChatResponse
+	var text strings.Builder
+	for event := range stream.Events() {
+		switch event := event.(type) {
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			delta, ok := event.Value.Delta.(*types.ContentBlockDeltaMemberText)
+			if !ok {
+				continue
+			}
+			text.WriteString(delta.Value)
+			if err := onChunk(delta.Value); err != nil {
+				return ChatResponse{}, err
+			}
+		case *types.ConverseStreamOutputMemberMessageStop:
+			response.FinishReason = string(event.Value.StopReason)
+		case *types.ConverseStreamOutputMemberMetadata:
+			response.Usage = converseUsage(event.Value.Usage)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return ChatResponse{}, ProcessError(err, aws.ToString(input.ModelId))
 	}
 
-	return response.Completion, nil
+	response.Text = text.String()
+	return response, nil
+}
+
+func converseUsage(usage *types.TokenUsage) Usage {
+	if usage == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     int(aws.ToInt32(usage.InputTokens)),
+		CompletionTokens: int(aws.ToInt32(usage.OutputTokens)),
+		TotalTokens:      int(aws.ToInt32(usage.TotalTokens)),
+	}
+}
+
+// InvokeModelWrapper encapsulates Amazon Bedrock actions used in the examples.
+// It contains a Bedrock Runtime client that is used to invoke foundation models.
+type InvokeModelWrapper struct {
+	BedrockRuntimeClient *bedrockruntime.Client
 }
 
 // Each model provider has their own individual request and response formats.
-// For the format, ranges, and default values for AI21 Labs Jurassic-2, refer to:
-// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-jurassic2.html
+// For the Anthropic Claude Messages API, refer to:
+// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-anthropic-claude-messages.html
+
+// CLAUDE_ANTHROPIC_VERSION is the Messages API version required by Bedrock.
+const CLAUDE_ANTHROPIC_VERSION = "bedrock-2023-05-31"
+
+// CLAUDE_DEFAULT_MAX_TOKENS is used when maxOutputTokens is not set, since the
+// Messages API requires max_tokens.
+const CLAUDE_DEFAULT_MAX_TOKENS = 1024
+
+type ClaudeMessagesRequest struct {
+	AnthropicVersion string          `json:"anthropic_version,omitempty"`
+	MaxTokens        int             `json:"max_tokens"`
+	System           string          `json:"system,omitempty"`
+	Messages         []ClaudeMessage `json:"messages"`
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"top_p,omitempty"`
+	StopSequences    []string        `json:"stop_sequences,omitempty"`
+}
 
-type Jurassic2Request struct {
-	Prompt      string  `json:"prompt"`
-	MaxTokens   int     `json:"maxTokens,omitempty"`
-	Temperature float64 `json:"temperature,omitempty"`
+type ClaudeMessage struct {
+	Role    string          `json:"role"`
+	Content []ClaudeContent `json:"content"`
 }
 
-type Jurassic2Response struct {
-	Completions []Completion `json:"completions"`
+type ClaudeContent struct {
+	Type   string             `json:"type"`
+	Text   string             `json:"text,omitempty"`
+	Source *ClaudeImageSource `json:"source,omitempty"`
 }
-type Completion struct {
-	Data Data `json:"data"`
+
+// ClaudeImageSource is the base64 encoded data of an image content block.
+type ClaudeImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"`
 }
-type Data struct {
-	Text string `json:"text"`
+
+type ClaudeMessagesResponse struct {
+	Content    []ClaudeContent `json:"content"`
+	StopReason string          `json:"stop_reason"`
+	Usage      ClaudeUsage     `json:"usage"`
 }
 
-// Invokes AI21 Labs Jurassic-2 on Amazon Bedrock to run an inference using the input
-// provided in the request body.
-func (wrapper InvokeModelWrapper) InvokeJurassic2(prompt string) (string, error) {
-	modelId := "ai21.j2-mid-v1"
+type ClaudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
 
-	body, err := json.Marshal(Jurassic2Request{
-		Prompt:      prompt,
-		MaxTokens:   200,
-		Temperature: 0.5,
-	})
-	if err != nil {
-		log.Fatal("failed to marshal", err)
-	}
+// ClaudeStreamEvent covers the fields of every streamed Messages API event
+// gq reads: message_start, content_block_delta and message_delta.
+type ClaudeStreamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Usage ClaudeUsage `json:"usage"`
+	} `json:"message"`
+	Delta *struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *ClaudeUsage `json:"usage"`
+}
 
-	output, err := wrapper.BedrockRuntimeClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String(modelId),
-		ContentType: aws.String("application/json"),
-		Body:        body,
-	})
-	if err != nil {
-		ProcessError(err, modelId)
+// text returns the concatenated text blocks of the response.
+func (r ClaudeMessagesResponse) text() string {
+	var text strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
 	}
+	return text.String()
+}
 
-	var response Jurassic2Response
-	if err := json.Unmarshal(output.Body, &response); err != nil {
-		log.Fatal("failed to unmarshal", err)
+func (u ClaudeUsage) usage() Usage {
+	return Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
 	}
-
-	return response.Completions[0].Data.Text, nil
 }
 
-// Each model provider has their own individual request and response formats.
-// For the format, ranges, and default values for Meta Llama 2 Chat, refer to:
-// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-meta.html
-
-type Llama2Request struct {
-	Prompt       string  `json:"prompt"`
-	MaxGenLength int     `json:"max_gen_len,omitempty"`
-	Temperature  float64 `json:"temperature,omitempty"`
-	TopP         float64 `json:"top_p,omitempty"`
+// claudeMessages maps the conversation onto Messages API messages. The roles
+// have to alternate, so consecutive messages of the same role are merged into
+// one message with several content blocks.
+func claudeMessages(req ChatRequest) []ClaudeMessage {
+	var messages []ClaudeMessage
+	for _, m := range req.Turns() {
+		role := "user"
+		if m.Role == RoleAssistant {
+			role = "assistant"
+		}
+		var blocks []ClaudeContent
+		for _, image := range m.Images {
+			blocks = append(blocks, ClaudeContent{Type: "image", Source: &ClaudeImageSource{Type: "base64", MediaType: image.MIMEType, Data: image.Data}})
+		}
+		blocks = append(blocks, ClaudeContent{Type: "text", Text: m.Content})
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == role {
+			messages[last].Content = append(messages[last].Content, blocks...)
+			continue
+		}
+		messages = append(messages, ClaudeMessage{Role: role, Content: blocks})
+	}
+	return messages
 }
 
-type Llama2Response struct {
-	Generation string `json:"generation"`
+// claudeMessagesRequest builds the InvokeModel body from the conversation and
+// the inference settings resolved for Converse.
+func claudeMessagesRequest(req ChatRequest, inferenceConfig *types.InferenceConfiguration) ClaudeMessagesRequest {
+	request := ClaudeMessagesRequest{
+		AnthropicVersion: CLAUDE_ANTHROPIC_VERSION,
+		MaxTokens:        CLAUDE_DEFAULT_MAX_TOKENS,
+		System:           req.SystemPrompt(),
+		Messages:         claudeMessages(req),
+		StopSequences:    inferenceConfig.StopSequences,
+	}
+	if inferenceConfig.MaxTokens != nil {
+		request.MaxTokens = int(*inferenceConfig.MaxTokens)
+	}
+	if inferenceConfig.Temperature != nil {
+		temperature := float64(*inferenceConfig.Temperature)
+		request.Temperature = &temperature
+	}
+	if inferenceConfig.TopP != nil {
+		topP := float64(*inferenceConfig.TopP)
+		request.TopP = &topP
+	}
+	return request
 }
 
-// Invokes Meta Llama 2 Chat on Amazon Bedrock to run an inference using the input
-// provided in the request body.
-func (wrapper InvokeModelWrapper) InvokeLlama2(prompt string) (string, error) {
-	modelId := "meta.llama2-13b-chat-v1"
+// Invokes Anthropic Claude on Amazon Bedrock through the Messages API. When
+// onChunk is set the answer is streamed with InvokeModelWithResponseStream.
+func (wrapper InvokeModelWrapper) InvokeClaude(ctx context.Context, modelId string, request ClaudeMessagesRequest, onChunk StreamFunc) (ChatResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	if onChunk != nil {
+		return wrapper.invokeClaudeStream(ctx, modelId, body, onChunk)
+	}
 
-	body, err := json.Marshal(Llama2Request{
-		Prompt:       prompt,
-		MaxGenLength: 512,
-		Temperature:  0.5,
-		TopP:         0.9,
+	output, err := wrapper.BedrockRuntimeClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(modelId),
+		ContentType: aws.String("application/json"),
+		Body:        body,
 	})
 	if err != nil {
-		log.Fatal("failed to marshal", err)
+		return ChatResponse{}, ProcessError(err, modelId)
+	}
+
+	var response ClaudeMessagesResponse
+	if err := json.Unmarshal(output.Body, &response); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to unmarshal: %w", err)
 	}
 
-	output, err := wrapper.BedrockRuntimeClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
+	return ChatResponse{Text: response.text(), FinishReason: response.StopReason, Usage: response.Usage.usage()}, nil
+}
+
+func (wrapper InvokeModelWrapper) invokeClaudeStream(ctx context.Context, modelId string, body []byte, onChunk StreamFunc) (ChatResponse, error) {
+	output, err := wrapper.BedrockRuntimeClient.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
 		ModelId:     aws.String(modelId),
 		ContentType: aws.String("application/json"),
 		Body:        body,
 	})
 	if err != nil {
-		ProcessError(err, modelId)
+		return ChatResponse{}, ProcessError(err, modelId)
 	}
 
-	var response Llama2Response
-	if err := json.Unmarshal(output.Body, &response); err != nil {
-		log.Fatal("failed to unmarshal", err)
+	stream := output.GetStream()
+	defer stream.Close()
+
+	var response ChatResponse
+	var text strings.Builder
+	var usage ClaudeUsage
+	for event := range stream.Events() {
+		payload, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+
+		var chunk ClaudeStreamEvent
+		if err := json.Unmarshal(payload.Value.Bytes, &chunk); err != nil {
+			return ChatResponse{}, fmt.Errorf("failed to unmarshal: %w", err)
+		}
+
+		switch chunk.Type {
+		case "message_start":
+			if chunk.Message != nil {
+				usage.InputTokens = chunk.Message.Usage.InputTokens
+			}
+		case "content_block_delta":
+			if chunk.Delta == nil || chunk.Delta.Type != "text_delta" {
+				continue
+			}
+			text.WriteString(chunk.Delta.Text)
+			if err := onChunk(chunk.Delta.Text); err != nil {
+				return ChatResponse{}, err
+			}
+		case "message_delta":
+			if chunk.Delta != nil {
+				response.FinishReason = chunk.Delta.StopReason
+			}
+			if chunk.Usage != nil {
+				usage.OutputTokens = chunk.Usage.OutputTokens
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return ChatResponse{}, ProcessError(err, modelId)
 	}
 
-	return response.Generation, nil
+	response.Text = text.String()
+	response.Usage = usage.usage()
+	return response, nil
 }
 
+// For the image models, refer to:
+// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-titan-image.html
+// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-diffusion-1-0-text-image.html
+
 type TitanImageRequest struct {
 	TaskType              string                `json:"taskType"`
 	TextToImageParams     TextToImageParams     `json:"textToImageParams"`
 	ImageGenerationConfig ImageGenerationConfig `json:"imageGenerationConfig"`
 }
 type TextToImageParams struct {
-	Text string `json:"text"`
+	Text         string `json:"text"`
+	NegativeText string `json:"negativeText,omitempty"`
 }
 type ImageGenerationConfig struct {
-	NumberOfImages int     `json:"numberOfImages"`
-	Quality        string  `json:"quality"`
-	CfgScale       float64 `json:"cfgScale"`
-	Height         int     `json:"height"`
-	Width          int     `json:"width"`
-	Seed           int64   `json:"seed"`
+	NumberOfImages int      `json:"numberOfImages"`
+	Quality        string   `json:"quality,omitempty"`
+	CfgScale       *float64 `json:"cfgScale,omitempty"`
+	Height         int      `json:"height,omitempty"`
+	Width          int      `json:"width,omitempty"`
+	Seed           *int64   `json:"seed,omitempty"`
 }
 
 type TitanImageResponse struct {
 	Images []string `json:"images"`
+	Error  string   `json:"error"`
 }
 
-// Invokes the Titan Image model to create an image using the input provided
-// in the request body.
-func (wrapper InvokeModelWrapper) InvokeTitanImage(prompt string, seed int64) (string, error) {
-	modelId := "amazon.titan-image-generator-v1"
+type StableDiffusionRequest struct {
+	TextPrompts []StableDiffusionPrompt `json:"text_prompts"`
+	CfgScale    *float64                `json:"cfg_scale,omitempty"`
+	Seed        *int64                  `json:"seed,omitempty"`
+	Height      int                     `json:"height,omitempty"`
+	Width       int                     `json:"width,omitempty"`
+	Samples     int                     `json:"samples"`
+}
+type StableDiffusionPrompt struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight"`
+}
 
-	body, err := json.Marshal(TitanImageRequest{
-		TaskType: "TEXT_IMAGE",
-		TextToImageParams: TextToImageParams{
-			Text: prompt,
-		},
-		ImageGenerationConfig: ImageGenerationConfig{
-			NumberOfImages: 1,
-			Quality:        "standard",
-			CfgScale:       8.0,
-			Height:         512,
-			Width:          512,
-			Seed:           seed,
-		},
-	})
+type StableDiffusionResponse struct {
+	Artifacts []struct {
+		Base64       string `json:"base64"`
+		FinishReason string `json:"finishReason"`
+	} `json:"artifacts"`
+}
+
+// StableImageRequest is the request of the Stable Diffusion 3 and Stable
+// Image models, which make one image per call.
+type StableImageRequest struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Seed           *int64 `json:"seed,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+	OutputFormat   string `json:"output_format"`
+}
+
+type StableImageResponse struct {
+	Images        []string  `json:"images"`
+	FinishReasons []*string `json:"finish_reasons"`
+}
+
+// stableImageAspectRatios are the aspect ratios the Stable Image models accept.
+var stableImageAspectRatios = []string{"1:1", "16:9", "21:9", "2:3", "3:2", "4:5", "5:4", "9:16", "9:21"}
+
+// imageModel reports whether the Bedrock model generates images rather than text.
+func imageModel(modelId string) bool {
+	return strings.Contains(modelId, "amazon.titan-image") ||
+		strings.Contains(modelId, "amazon.nova-canvas") ||
+		strings.Contains(modelId, "stability.")
+}
+
+// GenerateImages generates images with the Titan Image, Nova Canvas or
+// Stability AI model set by imageModel, Titan Image by default.
+func (_ AmznBedrockAIProvider) GenerateImages(ctx context.Context, req ImageRequest) ([]GeneratedImage, error) {
+	modelId := req.Model
+	if modelId == "" {
+		modelId = Config("bedrock").GetString("imageModel")
+	}
+	if modelId == "" {
+		modelId = TITAN_IMAGE_MODEL_ID
+	}
+	if !imageModel(modelId) {
+		return nil, ConfigError("bedrock", "%s doesn't generate images. Use an amazon.titan-image, amazon.nova-canvas or stability model", modelId)
+	}
+
+	client, err := newBedrockClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Verbose {
+		fmt.Println("\033[33mImage Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", modelId)
+		fmt.Println("Images: ", req.n())
+		fmt.Println("\033[0m")
+	}
+
+	wrapper := InvokeModelWrapper{BedrockRuntimeClient: client}
+	switch {
+	case strings.Contains(modelId, "stability.stable-diffusion-xl"):
+		return wrapper.InvokeStableDiffusion(ctx, modelId, req)
+	case strings.Contains(modelId, "stability."):
+		return wrapper.InvokeStableImage(ctx, modelId, req)
+	}
+	return wrapper.InvokeTitanImage(ctx, modelId, req)
+}
+
+// invokeImageModel sends the request body to the model and decodes its JSON
+// response into response.
+func (wrapper InvokeModelWrapper) invokeImageModel(ctx context.Context, modelId string, request any, response any) error {
+	body, err := json.Marshal(request)
 	if err != nil {
-		log.Fatal("failed to marshal", err)
+		return fmt.Errorf("failed to marshal: %w", err)
 	}
 
-	output, err := wrapper.BedrockRuntimeClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
+	output, err := wrapper.BedrockRuntimeClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
 		ModelId:     aws.String(modelId),
 		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
 		Body:        body,
 	})
 	if err != nil {
-		ProcessError(err, modelId)
+		return ProcessError(err, modelId)
 	}
 
-	var response TitanImageResponse
-	if err := json.Unmarshal(output.Body, &response); err != nil {
-		log.Fatal("failed to unmarshal", err)
+	if err := json.Unmarshal(output.Body, response); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
 	}
-
-	base64ImageData := response.Images[0]
-
-	return base64ImageData, nil
+	return nil
 }
 
-// Each model provider has their own individual request and response formats.
-// For the format, ranges, and default values for Amazon Titan Text, refer to:
-// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-titan-text.html
-type TitanTextRequest struct {
-	InputText            string               `json:"inputText"`
-	TextGenerationConfig TextGenerationConfig `json:"textGenerationConfig"`
-}
-
-type TextGenerationConfig struct {
-	Temperature   float64  `json:"temperature"`
-	TopP          float64  `json:"topP"`
-	MaxTokenCount int      `json:"maxTokenCount"`
-	StopSequences []string `json:"stopSequences,omitempty"`
-}
+// Invokes the Titan Image or Nova Canvas model, which share the same request
+// format, to create images from the prompt.
+func (wrapper InvokeModelWrapper) InvokeTitanImage(ctx context.Context, modelId string, req ImageRequest) ([]GeneratedImage, error) {
+	width, height, err := req.dimensions()
+	if err != nil {
+		return nil, ConfigError("bedrock", "%v", err)
+	}
 
-type TitanTextResponse struct {
-	InputTextTokenCount int      `json:"inputTextTokenCount"`
-	Results             []Result `json:"results"`
+	var response TitanImageResponse
+	err = wrapper.invokeImageModel(ctx, modelId, TitanImageRequest{
+		TaskType: "TEXT_IMAGE",
+		TextToImageParams: TextToImageParams{
+			Text:         req.Prompt,
+			NegativeText: req.NegativePrompt,
+		},
+		ImageGenerationConfig: ImageGenerationConfig{
+			NumberOfImages: req.n(),
+			Quality:        req.Quality,
+			CfgScale:       req.CfgScale,
+			Height:         height,
+			Width:          width,
+			Seed:           req.Seed,
+		},
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, &Error{Kind: ErrContentFiltered, Provider: "bedrock", Message: response.Error}
+	}
+	return decodeImages("bedrock", response.Images)
 }
 
-type Result struct {
-	TokenCount       int    `json:"tokenCount"`
-	OutputText       string `json:"outputText"`
-	CompletionReason string `json:"completionReason"`
-}
+// Invokes Stable Diffusion XL to create images from the prompt.
+func (wrapper InvokeModelWrapper) InvokeStableDiffusion(ctx context.Context, modelId string, req ImageRequest) ([]GeneratedImage, error) {
+	if err := req.rejectUnsupported("bedrock", modelId, "negativePrompt", "size", "cfgScale", "seed"); err != nil {
+		return nil, err
+	}
+	width, height, err := req.dimensions()
+	if err != nil {
+		return nil, ConfigError("bedrock", "%v", err)
+	}
 
-func (wrapper InvokeModelWrapper) InvokeTitanText(prompt string) (string, error) {
-	modelId := "amazon.titan-text-express-v1"
+	prompts := []StableDiffusionPrompt{{Text: req.Prompt, Weight: 1}}
+	if req.NegativePrompt != "" {
+		prompts = append(prompts, StableDiffusionPrompt{Text: req.NegativePrompt, Weight: -1})
+	}
 
-	body, err := json.Marshal(TitanTextRequest{
-		InputText: prompt,
-		TextGenerationConfig: TextGenerationConfig{
-			Temperature:   0,
-			TopP:          1,
-			MaxTokenCount: 4096,
-		},
-	})
+	var response StableDiffusionResponse
+	err = wrapper.invokeImageModel(ctx, modelId, StableDiffusionRequest{
+		TextPrompts: prompts,
+		CfgScale:    req.CfgScale,
+		Seed:        req.Seed,
+		Height:      height,
+		Width:       width,
+		Samples:     req.n(),
+	}, &response)
 	if err != nil {
-		log.Fatal("failed to marshal", err)
+		return nil, err
 	}
 
-	output, err := wrapper.BedrockRuntimeClient.InvokeModel(context.Background(), &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String(modelId),
-		ContentType: aws.String("application/json"),
-		Body:        body,
-	})
-	if err != nil {
-		ProcessError(err, modelId)
+	encoded := make([]string, 0, len(response.Artifacts))
+	for _, artifact := range response.Artifacts {
+		if artifact.FinishReason == "CONTENT_FILTERED" {
+			return nil, &Error{Kind: ErrContentFiltered, Provider: "bedrock", Message: "the image was filtered by the content policy of the model"}
+		}
+		encoded = append(encoded, artifact.Base64)
 	}
+	return decodeImages("bedrock", encoded)
+}
 
-	var response TitanTextResponse
-	if err := json.Unmarshal(output.Body, &response); err != nil {
-		log.Fatal("failed to unmarshal", err)
+// Invokes a Stable Diffusion 3 or Stable Image model to create images from the
+// prompt. These models make a single image per call and take an aspect ratio
+// rather than a size.
+func (wrapper InvokeModelWrapper) InvokeStableImage(ctx context.Context, modelId string, req ImageRequest) ([]GeneratedImage, error) {
+	if err := req.rejectUnsupported("bedrock", modelId, "negativePrompt", "size", "seed"); err != nil {
+		return nil, err
+	}
+	request := StableImageRequest{
+		Prompt:         req.Prompt,
+		NegativePrompt: req.NegativePrompt,
+		Seed:           req.Seed,
+		OutputFormat:   "png",
+	}
+	if strings.Contains(modelId, "sd3") {
+		request.Mode = "text-to-image"
+	}
+	if req.Size != "" {
+		width, height, err := req.dimensions()
+		if err != nil {
+			return nil, ConfigError("bedrock", "%v", err)
+		}
+		divisor := gcd(width, height)
+		request.AspectRatio = fmt.Sprintf("%d:%d", width/divisor, height/divisor)
+		if !slices.Contains(stableImageAspectRatios, request.AspectRatio) {
+			return nil, ConfigError("bedrock", "%s only supports the aspect ratios %s, not %s", modelId, strings.Join(stableImageAspectRatios, ", "), request.AspectRatio)
+		}
 	}
 
-	return response.Results[0].OutputText, nil
+	var encoded []string
+	for i := 0; i < req.n(); i++ {
+		var response StableImageResponse
+		if err := wrapper.invokeImageModel(ctx, modelId, request, &response); err != nil {
+			return nil, err
+		}
+		for _, reason := range response.FinishReasons {
+			if reason != nil {
+				return nil, &Error{Kind: ErrContentFiltered, Provider: "bedrock", Message: *reason}
+			}
+		}
+		encoded = append(encoded, response.Images...)
+	}
+	return decodeImages("bedrock", encoded)
 }
 
-func ProcessError(err error, modelId string) {
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// ProcessError turns a Converse or InvokeModel failure into a typed error with a hint
+// on how to fix it.
+func ProcessError(err error, modelId string) error {
 	errMsg := err.Error()
 	if strings.Contains(errMsg, "no such host") {
-		log.Printf(`The Bedrock service is not available in the selected region.
-                    Please double-check the service availability for your region at
-                    https://aws.amazon.com/about-aws/global-infrastructure/regional-product-services/.\n`)
-	} else if strings.Contains(errMsg, "Could not resolve the foundation model") {
-		log.Printf(`Could not resolve the foundation model from model identifier: \"%v\".
-                    Please verify that the requested model exists and is accessible
-                    within the specified region.\n
-                    `, modelId)
-	} else {
-		log.Printf("Couldn't invoke model: \"%v\". Here's why: %v\n", modelId, err)
+		return &Error{
+			Kind:     ErrNetwork,
+			Provider: "bedrock",
+			Message: "the Bedrock service is not available in the selected region. " +
+				"Check the service availability for your region at https://aws.amazon.com/about-aws/global-infrastructure/regional-product-services/",
+			Err: err,
+		}
+	}
+	if strings.Contains(errMsg, "Could not resolve the foundation model") {
+		return &Error{
+			Kind:     ErrModelNotFound,
+			Provider: "bedrock",
+			Message:  fmt.Sprintf("could not resolve the foundation model from model identifier %q. Verify that it exists and is accessible in the selected region", modelId),
+			Err:      err,
+		}
 	}
+	return classifyError("bedrock", fmt.Errorf("couldn't invoke model %q: %w", modelId, err))
 }
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// conversation has two user turns in a row, e.g. a question sent again after
+// a failed call, which the Bedrock APIs reject unless they are merged.
+var conversation = ChatRequest{Messages: []Message{
+	{Role: RoleSystem, Content: "Be terse."},
+	{Role: RoleUser, Content: "Capital of Washington?"},
+	{Role: RoleAssistant, Content: "Olympia"},
+	{Role: RoleUser, Content: "And of Oregon?"},
+	{Role: RoleUser, Content: "This one.", Images: []Image{{MIMEType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}}},
+	{Role: RoleSystem, Content: "Answer in English."},
+}}
+
+func TestConverseMessages(t *testing.T) {
+	messages, system := converseMessages(conversation)
+
+	if len(system) != 1 || system[0].(*types.SystemContentBlockMemberText).Value != "Be terse.\n\nAnswer in English." {
+		t.Errorf("unexpected system prompt %+v", system)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3 with the last user turns merged", len(messages))
+	}
+	for i, role := range []types.ConversationRole{types.ConversationRoleUser, types.ConversationRoleAssistant, types.ConversationRoleUser} {
+		if messages[i].Role != role {
+			t.Errorf("message %d: got role %s, want %s", i, messages[i].Role, role)
+		}
+	}
+
+	last := messages[2].Content
+	if len(last) != 3 {
+		t.Fatalf("got %d blocks in the merged message, want 3", len(last))
+	}
+	if text, ok := last[0].(*types.ContentBlockMemberText); !ok || text.Value != "And of Oregon?" {
+		t.Errorf("unexpected first block %+v", last[0])
+	}
+	if image, ok := last[1].(*types.ContentBlockMemberImage); !ok || image.Value.Format != types.ImageFormatPng {
+		t.Errorf("unexpected image block %+v", last[1])
+	}
+	if text, ok := last[2].(*types.ContentBlockMemberText); !ok || text.Value != "This one." {
+		t.Errorf("unexpected last block %+v", last[2])
+	}
+}
+
+func TestClaudeMessagesRequest(t *testing.T) {
+	inferenceConfig := &types.InferenceConfiguration{
+		Temperature:   aws.Float32(0.5),
+		StopSequences: []string{"END"},
+	}
+	body, err := json.Marshal(claudeMessagesRequest(conversation, inferenceConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"anthropic_version":"bedrock-2023-05-31","max_tokens":1024,"system":"Be terse.\n\nAnswer in English.",` +
+		`"messages":[{"role":"user","content":[{"type":"text","text":"Capital of Washington?"}]},` +
+		`{"role":"assistant","content":[{"type":"text","text":"Olympia"}]},` +
+		`{"role":"user","content":[{"type":"text","text":"And of Oregon?"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw=="}},{"type":"text","text":"This one."}]}],` +
+		`"temperature":0.5,"stop_sequences":["END"]}`
+	if string(body) != want {
+		t.Errorf("got body\n%s\nwant\n%s", body, want)
+	}
+
+	// maxOutputTokens and topP are sent when set.
+	inferenceConfig = &types.InferenceConfiguration{MaxTokens: aws.Int32(256), TopP: aws.Float32(0.25)}
+	request := claudeMessagesRequest(NewChatRequest("Hi", Options{}), inferenceConfig)
+	if request.MaxTokens != 256 || request.TopP == nil || *request.TopP != 0.25 || request.Temperature != nil || request.System != "" {
+		t.Errorf("unexpected request %+v", request)
+	}
+}
@@ -0,0 +1,259 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ANTHROPIC_DEFAULT_BASE_URL = "https://api.anthropic.com"
+	ANTHROPIC_API_VERSION      = "2023-06-01"
+)
+
+type AnthropicProvider struct{}
+
+func (_ AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	anthropicConfig := Config("anthropic")
+
+	apiKey := anthropicConfig.GetString("apiKey")
+	baseURL := anthropicConfig.GetString("baseURL")
+	modelName := req.Options.model(anthropicConfig.GetString("modelName"))
+	maxOutputTokens := req.Options.maxTokens(anthropicConfig.GetInt("maxOutputTokens"))
+	for _, setting := range [][2]string{{"apiKey", apiKey}, {"modelName", modelName}} {
+		if err := requireSetting("anthropic", setting[0], setting[1]); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	if err := requireVision("anthropic", "anthropic", modelName, req); err != nil {
+		return ChatResponse{}, err
+	}
+	if maxOutputTokens <= 0 {
+		maxOutputTokens = CLAUDE_DEFAULT_MAX_TOKENS
+	}
+
+	// A system prompt given with the question wins over the configured one.
+	system := req.SystemPrompt()
+	if system == "" {
+		system = anthropicConfig.GetString("system")
+	}
+
+	request := AnthropicRequest{
+		Model: modelName,
+		ClaudeMessagesRequest: ClaudeMessagesRequest{
+			MaxTokens:     maxOutputTokens,
+			System:        system,
+			Messages:      claudeMessages(req),
+			StopSequences: anthropicConfig.GetStringSlice("stopSequences"),
+		},
+	}
+	if req.Options.Temperature != nil || anthropicConfig.IsSet("temperature") {
+		temperature := req.Options.temperature(anthropicConfig.GetFloat64("temperature"))
+		request.Temperature = &temperature
+	}
+	if req.Options.TopP != nil || anthropicConfig.IsSet("topP") {
+		topP := req.Options.topP(anthropicConfig.GetFloat64("topP"))
+		request.TopP = &topP
+	}
+
+	client := NewAnthropicClient(baseURL, apiKey)
+
+	if req.Options.Verbose {
+		fmt.Println("\033[33mModel Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", modelName)
+		fmt.Println("Base URL: ", client.BaseURL)
+		if request.Temperature != nil {
+			fmt.Println("Temperature: ", *request.Temperature)
+		}
+		fmt.Println("Max Output Tokens: ", maxOutputTokens)
+		fmt.Println("\033[0m")
+	}
+
+	if req.Stream != nil {
+		response, err := client.MessagesStream(ctx, request, req.Stream)
+		return response, classifyError("anthropic", err)
+	}
+
+	response, err := client.Messages(ctx, request)
+	if err != nil {
+		return ChatResponse{}, classifyError("anthropic", err)
+	}
+	return ChatResponse{Text: response.text(), FinishReason: response.StopReason, Usage: response.Usage.usage()}, nil
+}
+
+// AnthropicRequest is the Messages API request body. The API is the one
+// Claude also speaks on Bedrock, plus the model and stream fields.
+type AnthropicRequest struct {
+	Model string `json:"model"`
+	ClaudeMessagesRequest
+	Stream bool `json:"stream,omitempty"`
+}
+
+// AnthropicClient is a minimal client for the Anthropic Messages API.
+// See https://docs.anthropic.com/en/api/messages
+type AnthropicClient struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewAnthropicClient returns a client for the given base URL, falling back to
+// the public API when it is empty.
+func NewAnthropicClient(baseURL string, apiKey string) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = ANTHROPIC_DEFAULT_BASE_URL
+	}
+	return &AnthropicClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// AnthropicError is returned when the API answers with a non-2xx status or
+// streams an error event.
+type AnthropicError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *AnthropicError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("anthropic: unexpected status %d", e.StatusCode)
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("anthropic: %s (%s)", e.Message, e.Type)
+	}
+	return fmt.Sprintf("anthropic: %s (%s, status %d)", e.Message, e.Type, e.StatusCode)
+}
+
+// anthropicErrorBody is the body of error responses and error stream events.
+type anthropicErrorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Messages calls /v1/messages with streaming disabled.
+func (c *AnthropicClient) Messages(ctx context.Context, req AnthropicRequest) (ClaudeMessagesResponse, error) {
+	req.Stream = false
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return ClaudeMessagesResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var response ClaudeMessagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return ClaudeMessagesResponse{}, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return response, nil
+}
+
+// MessagesStream calls /v1/messages with streaming enabled, reads the
+// server-sent events and hands every chunk of generated text to onChunk.
+func (c *AnthropicClient) MessagesStream(ctx context.Context, req AnthropicRequest, onChunk StreamFunc) (ChatResponse, error) {
+	req.Stream = true
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var response ChatResponse
+	var text strings.Builder
+	var usage ClaudeUsage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			// Event names are repeated in the type field of the data, and
+			// blank lines only separate the events.
+			continue
+		}
+		data = strings.TrimSpace(data)
+
+		var event ClaudeStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return ChatResponse{}, fmt.Errorf("failed to unmarshal: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage.InputTokens = event.Message.Usage.InputTokens
+			}
+		case "content_block_delta":
+			if event.Delta == nil || event.Delta.Type != "text_delta" {
+				continue
+			}
+			text.WriteString(event.Delta.Text)
+			if err := onChunk(event.Delta.Text); err != nil {
+				return ChatResponse{}, err
+			}
+		case "message_delta":
+			if event.Delta != nil {
+				response.FinishReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			var body anthropicErrorBody
+			json.Unmarshal([]byte(data), &body)
+			return ChatResponse{}, &AnthropicError{Type: body.Error.Type, Message: body.Error.Message}
+		case "message_stop":
+			response.Text = text.String()
+			response.Usage = usage.usage()
+			return response, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ChatResponse{}, err
+	}
+	return ChatResponse{}, fmt.Errorf("anthropic: the stream ended before the message was complete")
+}
+
+// send posts the request and turns non-2xx answers into an *AnthropicError.
+// The caller must close the body of the returned response.
+func (c *AnthropicClient) send(ctx context.Context, req AnthropicRequest) (*http.Response, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.APIKey)
+	httpReq.Header.Set("anthropic-version", ANTHROPIC_API_VERSION)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		apiErr := &AnthropicError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header)}
+		var body anthropicErrorBody
+		if raw, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(raw, &body) == nil {
+			apiErr.Type = body.Error.Type
+			apiErr.Message = body.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
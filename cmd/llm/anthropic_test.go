@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func useAnthropicConfig(t *testing.T, baseURL string) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("anthropic.apiKey", "test-key")
+	viper.Set("anthropic.baseURL", baseURL)
+	viper.Set("anthropic.modelName", "claude-3-5-sonnet-20240620")
+	viper.Set("anthropic.temperature", 0.2)
+	viper.Set("anthropic.maxOutputTokens", 256)
+}
+
+// decodeAnthropicRequest checks the headers of a Messages API call and returns its body.
+func decodeAnthropicRequest(t *testing.T, r *http.Request) AnthropicRequest {
+	t.Helper()
+	if r.URL.Path != "/v1/messages" || r.Method != http.MethodPost {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}
+	if got := r.Header.Get("x-api-key"); got != "test-key" {
+		t.Errorf("x-api-key = %q, want test-key", got)
+	}
+	if got := r.Header.Get("anthropic-version"); got != ANTHROPIC_API_VERSION {
+		t.Errorf("anthropic-version = %q, want %s", got, ANTHROPIC_API_VERSION)
+	}
+	var req AnthropicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestAnthropicProviderChat(t *testing.T) {
+	var got AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = decodeAnthropicRequest(t, r)
+		json.NewEncoder(w).Encode(map[string]any{
+			"type":        "message",
+			"role":        "assistant",
+			"content":     []map[string]string{{"type": "text", "text": "Olym"}, {"type": "text", "text": "pia"}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]int{"input_tokens": 12, "output_tokens": 3},
+		})
+	}))
+	defer server.Close()
+	useAnthropicConfig(t, server.URL)
+
+	req := ChatRequest{Messages: []Message{
+		{Role: RoleSystem, Content: "Answer in one word."},
+		{Role: RoleUser, Content: "What is the capital of Washington?"},
+		{Role: RoleAssistant, Content: "Olympia"},
+		{Role: RoleUser, Content: "Are you sure?"},
+	}}
+	response, err := AnthropicProvider{}.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Text != "Olympia" || response.FinishReason != "end_turn" {
+		t.Errorf("got %q (%s), want Olympia (end_turn)", response.Text, response.FinishReason)
+	}
+	if response.Usage != (Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}) {
+		t.Errorf("unexpected usage %+v", response.Usage)
+	}
+	if got.Model != "claude-3-5-sonnet-20240620" || got.MaxTokens != 256 || got.Stream {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if got.Temperature == nil || *got.Temperature != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", got.Temperature)
+	}
+	if got.System != "Answer in one word." {
+		t.Errorf("system = %q, want the system message", got.System)
+	}
+	if len(got.Messages) != 3 || got.Messages[1].Role != "assistant" || got.Messages[2].Content[0].Text != "Are you sure?" {
+		t.Errorf("unexpected messages %+v", got.Messages)
+	}
+}
+
+func TestAnthropicProviderStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Oly"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"mpia"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}`,
+		`{"type":"message_stop"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if req := decodeAnthropicRequest(t, r); !req.Stream {
+			t.Error("stream was not requested")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typed struct{ Type string }
+			json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+	useAnthropicConfig(t, server.URL)
+
+	var chunks []string
+	req := NewChatRequest("What is the capital of Washington?", Options{})
+	req.Stream = func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}
+	response, err := AnthropicProvider{}.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(chunks, "|") != "Oly|mpia" {
+		t.Errorf("got chunks %q", chunks)
+	}
+	if response.Text != "Olympia" || response.FinishReason != "end_turn" {
+		t.Errorf("got %q (%s), want Olympia (end_turn)", response.Text, response.FinishReason)
+	}
+	if response.Usage != (Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}) {
+		t.Errorf("unexpected usage %+v", response.Usage)
+	}
+}
+
+func TestAnthropicProviderErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		status int
+		body   string
+		want   ErrorKind
+	}{
+		"auth":       {http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, ErrAuth},
+		"rate limit": {http.StatusTooManyRequests, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, ErrRateLimit},
+		"model":      {http.StatusNotFound, `{"type":"error","error":{"type":"not_found_error","message":"model: claude-9"}}`, ErrModelNotFound},
+		"overloaded": {529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, ErrNetwork},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+			useAnthropicConfig(t, server.URL)
+
+			_, err := AnthropicProvider{}.Chat(context.Background(), NewChatRequest("Hi", Options{}))
+			if KindOf(err) != tc.want {
+				t.Errorf("got %v (%s), want %s", err, KindOf(err), tc.want)
+			}
+			if delay := retryAfter(err); delay.Seconds() != 7 {
+				t.Errorf("retry after = %s, want 7s", delay)
+			}
+		})
+	}
+}
@@ -2,60 +2,271 @@ package llm
 
 import (
 	"context"
-    "log"
-    "fmt"
-    "errors"
-	"github.com/spf13/viper"
-  	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
-    "github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 )
 
 type AzureOpenAIProvider struct{}
 
-func (_ AzureOpenAIProvider) Chat(userQuery string, verbose bool) (string, error) {
-    
-    azureOpenAIConfig := viper.Sub("azureOpenAI")
-
-  	apiKey := azureOpenAIConfig.GetString("apiKey")
-    modelDeploymentID := azureOpenAIConfig.GetString("modelDeploymentID")
-    modelEndpoint := azureOpenAIConfig.GetString("modelEndpoint")
-    temperature := azureOpenAIConfig.GetFloat64("temperature")
-    maxOutputTokens := azureOpenAIConfig.GetInt32("maxOutputTokens")
-
-    
-    keyCredential := azcore.NewKeyCredential(apiKey)
-    client, err := azopenai.NewClientWithKeyCredential(modelEndpoint, keyCredential, nil)
-    
-    if err != nil {
-      log.Fatal(err)
-      return  "", errors.New("Initializing Azure OpenAI Client Failed")
-    }
-    messages := []azopenai.ChatRequestMessageClassification{
-            &azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent(userQuery)},
-        }
-
-    if verbose {
-      fmt.Println("\033[33mModel Params:\033[0m")
-      fmt.Println("\033[36mModel Deployment ID: ", modelDeploymentID)
-      fmt.Println("Model Endpoint: ", modelEndpoint)
-      fmt.Println("Temperature: ", temperature)
-      fmt.Println("Max Output Tokens: ", maxOutputTokens)
-      fmt.Println("\033[0m")
-    }
-
-    resp, err := client.GetChatCompletions(context.TODO(), azopenai.ChatCompletionsOptions{
-            Messages:       messages,
-            DeploymentName: &modelDeploymentID,
-            MaxTokens:      to.Ptr(int32(maxOutputTokens)),
-            Temperature:    to.Ptr(float32(temperature)),
-        }, nil)
-  
+func (_ AzureOpenAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	azureOpenAIConfig := Config("azureOpenAI")
+
+	apiKey := azureOpenAIConfig.GetString("apiKey")
+	modelDeploymentID := req.Options.model(azureOpenAIConfig.GetString("modelDeploymentID"))
+	modelEndpoint := azureOpenAIConfig.GetString("modelEndpoint")
+
+	for _, setting := range [][2]string{{"apiKey", apiKey}, {"modelDeploymentID", modelDeploymentID}, {"modelEndpoint", modelEndpoint}} {
+		if err := requireSetting("azureOpenAI", setting[0], setting[1]); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	if err := requireVision("azureOpenAI", "azureOpenAI", modelDeploymentID, req); err != nil {
+		return ChatResponse{}, err
+	}
+
+	client, err := newAzureClient(apiKey, modelEndpoint)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	options := azureChatOptions(azureOpenAIConfig, modelDeploymentID, req)
+
+	if req.Options.Verbose {
+		fmt.Println("\033[33mModel Params:\033[0m")
+		fmt.Println("\033[36mModel Deployment ID: ", modelDeploymentID)
+		fmt.Println("Model Endpoint: ", modelEndpoint)
+		if options.Temperature != nil {
+			fmt.Println("Temperature: ", *options.Temperature)
+		}
+		if options.MaxTokens != nil {
+			fmt.Println("Max Output Tokens: ", *options.MaxTokens)
+		}
+		fmt.Println("\033[0m")
+	}
+
+	if req.Stream != nil {
+		return azureStream(ctx, client, options, req.Stream)
+	}
+
+	resp, err := client.GetChatCompletions(ctx, options, nil)
+
+	if err != nil {
+		return ChatResponse{}, classifyError("azureOpenAI", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return ChatResponse{}, &Error{Provider: "azureOpenAI", Message: "the model returned no choices"}
+	}
+	choice := resp.Choices[0]
+	if choice.Message == nil || choice.Message.Content == nil {
+		return ChatResponse{}, &Error{Kind: ErrContentFiltered, Provider: "azureOpenAI", Message: "the model returned no content"}
+	}
+	response := ChatResponse{Text: *choice.Message.Content}
+	if choice.FinishReason != nil {
+		response.FinishReason = string(*choice.FinishReason)
+	}
+	response.Usage = azureUsage(resp.Usage)
+
+	return response, nil
+}
+
+// azureChatOptions returns the options of the chat completion. Unset options
+// are left out, so the deployment's own defaults apply.
+func azureChatOptions(azureOpenAIConfig ProviderConfig, modelDeploymentID string, req ChatRequest) azopenai.ChatCompletionsOptions {
+	options := azopenai.ChatCompletionsOptions{
+		Messages:       azureMessages(req.Messages),
+		DeploymentName: &modelDeploymentID,
+	}
+	if maxOutputTokens := req.Options.maxTokens(azureOpenAIConfig.GetInt("maxOutputTokens")); maxOutputTokens > 0 {
+		options.MaxTokens = to.Ptr(int32(maxOutputTokens))
+	}
+	if req.Options.Temperature != nil || azureOpenAIConfig.IsSet("temperature") {
+		options.Temperature = to.Ptr(float32(req.Options.temperature(azureOpenAIConfig.GetFloat64("temperature"))))
+	}
+	if req.Options.TopP != nil || azureOpenAIConfig.IsSet("topP") {
+		options.TopP = to.Ptr(float32(req.Options.topP(azureOpenAIConfig.GetFloat64("topP"))))
+	}
+	if req.Schema != nil {
+		// The API version of the SDK only has the JSON mode, the schema is in the instructions.
+		options.ResponseFormat = &azopenai.ChatCompletionsJSONResponseFormat{}
+	}
+	return options
+}
+
+func newAzureClient(apiKey string, modelEndpoint string) (*azopenai.Client, error) {
+	keyCredential := azcore.NewKeyCredential(apiKey)
+	// Retries are made by the retry layer of gq, see retry.go.
+	clientOptions := &azopenai.ClientOptions{ClientOptions: azcore.ClientOptions{Retry: policy.RetryOptions{MaxRetries: -1}}}
+	client, err := azopenai.NewClientWithKeyCredential(modelEndpoint, keyCredential, clientOptions)
+	if err != nil {
+		return nil, &Error{Kind: ErrBadConfig, Provider: "azureOpenAI", Message: "initializing the Azure OpenAI client failed", Err: err}
+	}
+	return client, nil
+}
+
+// GenerateImages generates images with the DALL·E deployment set by
+// imageDeploymentID.
+func (_ AzureOpenAIProvider) GenerateImages(ctx context.Context, req ImageRequest) ([]GeneratedImage, error) {
+	azureOpenAIConfig := Config("azureOpenAI")
+
+	apiKey := azureOpenAIConfig.GetString("apiKey")
+	deploymentID := req.Model
+	if deploymentID == "" {
+		deploymentID = azureOpenAIConfig.GetString("imageDeploymentID")
+	}
+	modelEndpoint := azureOpenAIConfig.GetString("modelEndpoint")
+	for _, setting := range [][2]string{{"apiKey", apiKey}, {"imageDeploymentID", deploymentID}, {"modelEndpoint", modelEndpoint}} {
+		if err := requireSetting("azureOpenAI", setting[0], setting[1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := req.rejectUnsupported("azureOpenAI", deploymentID, "size", "quality"); err != nil {
+		return nil, err
+	}
+
+	client, err := newAzureClient(apiKey, modelEndpoint)
 	if err != nil {
-      log.Fatal(err)
-      return "", errors.New("Azure OpenAI Chat Completion Failed")
+		return nil, err
+	}
+
+	options := azopenai.ImageGenerationOptions{
+		Prompt:         to.Ptr(req.Prompt),
+		DeploymentName: to.Ptr(deploymentID),
+		N:              to.Ptr(int32(req.n())),
+		ResponseFormat: to.Ptr(azopenai.ImageGenerationResponseFormatBase64),
+	}
+	if req.Size != "" {
+		options.Size = to.Ptr(azopenai.ImageSize(req.Size))
+	}
+	if req.Quality != "" {
+		options.Quality = to.Ptr(azopenai.ImageGenerationQuality(req.Quality))
+	}
+
+	if req.Verbose {
+		fmt.Println("\033[33mImage Params:\033[0m")
+		fmt.Println("\033[36mImage Deployment ID: ", deploymentID)
+		fmt.Println("Model Endpoint: ", modelEndpoint)
+		fmt.Println("Images: ", req.n())
+		fmt.Println("\033[0m")
+	}
+
+	resp, err := client.GetImageGenerations(ctx, options, nil)
+	if err != nil {
+		return nil, classifyError("azureOpenAI", err)
+	}
+
+	images := make([]GeneratedImage, 0, len(resp.Data))
+	for _, data := range resp.Data {
+		if data.Base64Data == nil {
+			continue
+		}
+		image, err := decodeImage("azureOpenAI", *data.Base64Data)
+		if err != nil {
+			return nil, err
+		}
+		generated := GeneratedImage{Image: image}
+		if data.RevisedPrompt != nil {
+			generated.RevisedPrompt = *data.RevisedPrompt
+		}
+		images = append(images, generated)
 	}
+	return images, nil
+}
 
-	return *resp.Choices[0].Message.Content, nil
+func azureMessages(messages []Message) []azopenai.ChatRequestMessageClassification {
+	out := make([]azopenai.ChatRequestMessageClassification, 0, len(messages))
+	for _, m := range messages {
+		switch m.Role {
+		case RoleSystem:
+			out = append(out, &azopenai.ChatRequestSystemMessage{Content: to.Ptr(m.Content)})
+		case RoleAssistant:
+			out = append(out, &azopenai.ChatRequestAssistantMessage{Content: to.Ptr(m.Content)})
+		default:
+			out = append(out, &azopenai.ChatRequestUserMessage{Content: azureUserContent(m)})
+		}
+	}
+	return out
+}
 
+// azureUserContent returns the content of a user message, in the multi-part
+// form when it carries images.
+func azureUserContent(m Message) azopenai.ChatRequestUserMessageContent {
+	if len(m.Images) == 0 {
+		return azopenai.NewChatRequestUserMessageContent(m.Content)
+	}
+	parts := []azopenai.ChatCompletionRequestMessageContentPartClassification{
+		&azopenai.ChatCompletionRequestMessageContentPartText{Text: to.Ptr(m.Content)},
+	}
+	for _, image := range m.Images {
+		parts = append(parts, &azopenai.ChatCompletionRequestMessageContentPartImage{
+			ImageURL: &azopenai.ChatCompletionRequestMessageContentPartImageURL{URL: to.Ptr(image.dataURI())},
+		})
+	}
+	return azopenai.NewChatRequestUserMessageContent(parts)
+}
+
+// azureUsage returns the token usage of a response, counting the fields the
+// service left out as 0.
+func azureUsage(usage *azopenai.CompletionsUsage) Usage {
+	if usage == nil {
+		return Usage{}
+	}
+	tokens := func(count *int32) int {
+		if count == nil {
+			return 0
+		}
+		return int(*count)
+	}
+	return Usage{
+		PromptTokens:     tokens(usage.PromptTokens),
+		CompletionTokens: tokens(usage.CompletionTokens),
+		TotalTokens:      tokens(usage.TotalTokens),
+	}
+}
+
+// azureStream streams the answer to onChunk. The API version of the SDK can't
+// ask for the usage of a stream, so it is only known when the service sends
+// it anyway, and reported as unavailable otherwise.
+func azureStream(ctx context.Context, client *azopenai.Client, options azopenai.ChatCompletionsOptions, onChunk StreamFunc) (ChatResponse, error) {
+	resp, err := client.GetChatCompletionsStream(ctx, options, nil)
+	if err != nil {
+		return ChatResponse{}, classifyError("azureOpenAI", err)
+	}
+	defer resp.ChatCompletionsStream.Close()
+
+	var response ChatResponse
+	var text strings.Builder
+	for {
+		chunk, err := resp.ChatCompletionsStream.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ChatResponse{}, classifyError("azureOpenAI", err)
+		}
+		if chunk.Usage != nil {
+			response.Usage = azureUsage(chunk.Usage)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				response.FinishReason = string(*choice.FinishReason)
+			}
+			if choice.Delta == nil || choice.Delta.Content == nil {
+				continue
+			}
+			text.WriteString(*choice.Delta.Content)
+			if err := onChunk(*choice.Delta.Content); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+	}
+	response.Text = text.String()
+	return response, nil
 }
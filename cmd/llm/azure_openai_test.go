@@ -0,0 +1,23 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+func TestAzureUsage(t *testing.T) {
+	for name, tc := range map[string]struct {
+		usage *azopenai.CompletionsUsage
+		want  Usage
+	}{
+		"missing":  {usage: nil, want: Usage{}},
+		"complete": {usage: &azopenai.CompletionsUsage{PromptTokens: to.Ptr[int32](12), CompletionTokens: to.Ptr[int32](30), TotalTokens: to.Ptr[int32](42)}, want: Usage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42}},
+		"partial":  {usage: &azopenai.CompletionsUsage{PromptTokens: to.Ptr[int32](12)}, want: Usage{PromptTokens: 12}},
+	} {
+		if got := azureUsage(tc.usage); got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+)
+
+// Role identifies the author of a message in a conversation.
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is a single role-tagged turn of a conversation.
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+	// Images are sent along with the content to the models that can see them.
+	Images []Image `json:"images,omitempty"`
+}
+
+// Image is an image attached to a message, e.g. a screenshot or a diagram.
+type Image struct {
+	// MIMEType is one of image/png, image/jpeg, image/webp and image/gif.
+	MIMEType string `json:"mimeType"`
+	Data     []byte `json:"data"`
+}
+
+// format returns the image format named by the MIME type, e.g. png.
+func (i Image) format() string {
+	return strings.TrimPrefix(i.MIMEType, "image/")
+}
+
+// dataURI returns the image as a base64 data URI.
+func (i Image) dataURI() string {
+	return "data:" + i.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// Options holds the per-call generation settings. Zero values mean
+// "use whatever the provider section of the config file says".
+type Options struct {
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+	TopP        *float64
+	Verbose     bool
+}
+
+// StreamFunc receives each chunk of generated text as soon as it arrives.
+type StreamFunc func(chunk string) error
+
+// ChatRequest is everything a provider needs to answer a single call.
+// When Stream is set the provider streams the answer through it chunk by
+// chunk; the full answer is still returned in the ChatResponse.
+type ChatRequest struct {
+	Messages []Message
+	Options  Options
+	Stream   StreamFunc
+	// Schema, when set, asks for an answer in JSON matching it.
+	Schema *Schema
+}
+
+// Usage reports the token accounting returned by the provider, when available.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// ChatResponse is the provider-agnostic answer to a ChatRequest.
+type ChatResponse struct {
+	Text         string
+	FinishReason string
+	Usage        Usage
+}
+
+// ChatProvider is implemented by every LLM backend gq can talk to.
+type ChatProvider interface {
+	Chat(ctx context.Context, req ChatRequest) (ChatResponse, error)
+}
+
+// NewChatRequest builds a request holding a single user message.
+func NewChatRequest(userQuery string, opts Options) ChatRequest {
+	return ChatRequest{
+		Messages: []Message{{Role: RoleUser, Content: userQuery}},
+		Options:  opts,
+	}
+}
+
+// SystemPrompt returns the concatenated content of every system message.
+func (r ChatRequest) SystemPrompt() string {
+	var parts []string
+	for _, m := range r.Messages {
+		if m.Role == RoleSystem {
+			parts = append(parts, m.Content)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// HasImages reports whether any message of the conversation carries an image.
+func (r ChatRequest) HasImages() bool {
+	for _, m := range r.Messages {
+		if len(m.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Turns returns the non-system messages in order.
+func (r ChatRequest) Turns() []Message {
+	turns := make([]Message, 0, len(r.Messages))
+	for _, m := range r.Messages {
+		if m.Role != RoleSystem {
+			turns = append(turns, m)
+		}
+	}
+	return turns
+}
+
+func (o Options) model(fallback string) string {
+	if o.Model != "" {
+		return o.Model
+	}
+	return fallback
+}
+
+func (o Options) temperature(fallback float64) float64 {
+	if o.Temperature != nil {
+		return *o.Temperature
+	}
+	return fallback
+}
+
+func (o Options) maxTokens(fallback int) int {
+	if o.MaxTokens > 0 {
+		return o.MaxTokens
+	}
+	return fallback
+}
+
+func (o Options) topP(fallback float64) float64 {
+	if o.TopP != nil {
+		return *o.TopP
+	}
+	return fallback
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/spf13/viper"
+)
+
+// TestTopPFromConfig checks that the topP of the provider section is sent,
+// and that --top-p overrides it, whatever the provider.
+func TestTopPFromConfig(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Path == "/api/chat" {
+			json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": "ok"}, "done": true})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "ok"}}}})
+	}))
+	defer server.Close()
+
+	topP := func() any {
+		if options, ok := body["options"].(map[string]any); ok {
+			return options["top_p"]
+		}
+		return body["top_p"]
+	}
+	flag := 0.5
+	for name, provider := range map[string]ChatProvider{
+		"ollama":          OllamaProvider{},
+		"endpoints.local": NewOpenAICompatibleProvider("local"),
+	} {
+		viper.Reset()
+		viper.Set("ollama.host", server.URL)
+		viper.Set("ollama.modelName", "llama3")
+		viper.Set("endpoints.local.baseURL", server.URL)
+		viper.Set("endpoints.local.modelName", "gpt-4o-mini")
+
+		if _, err := provider.Chat(context.Background(), NewChatRequest("Hi", Options{})); err != nil {
+			t.Fatal(err)
+		}
+		if got := topP(); got != nil {
+			t.Errorf("%s: top_p sent without being set: %v", name, got)
+		}
+
+		viper.Set(name+".topP", 0.9)
+		if _, err := provider.Chat(context.Background(), NewChatRequest("Hi", Options{})); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := topP().(float64); !ok || got < 0.89 || got > 0.91 {
+			t.Errorf("%s: got top_p %v, want 0.9 from the config", name, topP())
+		}
+
+		if _, err := provider.Chat(context.Background(), NewChatRequest("Hi", Options{TopP: &flag})); err != nil {
+			t.Fatal(err)
+		}
+		if got := topP(); got != 0.5 {
+			t.Errorf("%s: got top_p %v, want 0.5 from --top-p", name, got)
+		}
+	}
+	viper.Reset()
+}
+
+// TestUnsetOptionsLeftOut checks that the temperature and the maximum number
+// of tokens are only sent when the config or the flags set them.
+func TestUnsetOptionsLeftOut(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	req := NewChatRequest("Hi", Options{})
+
+	azure := azureChatOptions(Config("azureOpenAI"), "gpt-4o", req)
+	if azure.Temperature != nil || azure.MaxTokens != nil || azure.TopP != nil {
+		t.Errorf("azureOpenAI: unset options were sent: %+v", azure)
+	}
+	gemini := &genai.GenerativeModel{}
+	configureGemini(gemini, Config("gemini"), req)
+	if gemini.Temperature != nil || gemini.MaxOutputTokens != nil || gemini.TopP != nil {
+		t.Errorf("gemini: unset options were sent: %+v", gemini.GenerationConfig)
+	}
+
+	// A temperature of 0 is sent when it is set.
+	viper.Set("azureOpenAI.temperature", 0)
+	viper.Set("azureOpenAI.maxOutputTokens", 256)
+	viper.Set("gemini.temperature", 0)
+	viper.Set("gemini.maxOutputTokens", 256)
+	azure = azureChatOptions(Config("azureOpenAI"), "gpt-4o", req)
+	if azure.Temperature == nil || *azure.Temperature != 0 || azure.MaxTokens == nil || *azure.MaxTokens != 256 {
+		t.Errorf("azureOpenAI: the configured options were not sent: %+v", azure)
+	}
+	gemini = &genai.GenerativeModel{}
+	configureGemini(gemini, Config("gemini"), req)
+	if gemini.Temperature == nil || *gemini.Temperature != 0 || gemini.MaxOutputTokens == nil || *gemini.MaxOutputTokens != 256 {
+		t.Errorf("gemini: the configured options were not sent: %+v", gemini.GenerationConfig)
+	}
+
+	// The flags win over the config.
+	temperature := 0.7
+	req = NewChatRequest("Hi", Options{Temperature: &temperature, MaxTokens: 64})
+	azure = azureChatOptions(Config("azureOpenAI"), "gpt-4o", req)
+	if *azure.Temperature != 0.7 || *azure.MaxTokens != 64 {
+		t.Errorf("azureOpenAI: the flags were not sent: %+v", azure)
+	}
+	gemini = &genai.GenerativeModel{}
+	configureGemini(gemini, Config("gemini"), req)
+	if *gemini.Temperature != 0.7 || *gemini.MaxOutputTokens != 64 {
+		t.Errorf("gemini: the flags were not sent: %+v", gemini.GenerationConfig)
+	}
+}
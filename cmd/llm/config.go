@@ -0,0 +1,45 @@
+package llm
+
+import "github.com/spf13/viper"
+
+// ProviderConfig reads the settings of one provider section of the config.
+// Unlike viper.Sub it honors environment variable bindings and is safe to use
+// when the section is missing from the config file.
+type ProviderConfig string
+
+// Config returns the settings of the given provider section.
+func Config(section string) ProviderConfig {
+	return ProviderConfig(section)
+}
+
+func (c ProviderConfig) key(name string) string {
+	return string(c) + "." + name
+}
+
+func (c ProviderConfig) IsSet(name string) bool {
+	return viper.IsSet(c.key(name))
+}
+
+func (c ProviderConfig) GetString(name string) string {
+	return viper.GetString(c.key(name))
+}
+
+func (c ProviderConfig) GetFloat64(name string) float64 {
+	return viper.GetFloat64(c.key(name))
+}
+
+func (c ProviderConfig) GetInt(name string) int {
+	return viper.GetInt(c.key(name))
+}
+
+func (c ProviderConfig) GetBool(name string) bool {
+	return viper.GetBool(c.key(name))
+}
+
+func (c ProviderConfig) GetStringSlice(name string) []string {
+	return viper.GetStringSlice(c.key(name))
+}
+
+func (c ProviderConfig) GetStringMapString(name string) map[string]string {
+	return viper.GetStringMapString(c.key(name))
+}
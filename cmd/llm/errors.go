@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrorKind classifies provider failures so callers can react to them
+// without parsing messages.
+type ErrorKind int
+
+const (
+	ErrUnknown ErrorKind = iota
+	ErrAuth
+	ErrRateLimit
+	ErrQuota
+	ErrModelNotFound
+	ErrContentFiltered
+	ErrNetwork
+	ErrTimeout
+	ErrBadConfig
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrUnknown:         "error",
+	ErrAuth:            "authentication error",
+	ErrRateLimit:       "rate limited",
+	ErrQuota:           "quota exceeded",
+	ErrModelNotFound:   "model not found",
+	ErrContentFiltered: "content filtered",
+	ErrNetwork:         "network error",
+	ErrTimeout:         "timeout",
+	ErrBadConfig:       "configuration error",
+}
+
+func (k ErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+// Error is the error returned by providers. Message explains the failure in
+// terms of gq settings; Err keeps the underlying SDK or transport error.
+type Error struct {
+	Kind     ErrorKind
+	Provider string
+	Message  string
+	Err      error
+	// RetryAfter is the delay the service asked to wait before retrying, if any.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Kind.String()
+	}
+	if e.Provider != "" {
+		msg = e.Provider + ": " + msg
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of a provider error, or ErrUnknown for any other error.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ErrUnknown
+}
+
+// ConfigError reports a missing or invalid setting.
+func ConfigError(provider string, format string, args ...any) *Error {
+	return &Error{Kind: ErrBadConfig, Provider: provider, Message: fmt.Sprintf(format, args...)}
+}
+
+// requireSetting returns a bad-config error when a required setting is empty.
+func requireSetting(provider string, key string, value string) error {
+	if value == "" {
+		return ConfigError(provider, "%s.%s is not set", provider, key)
+	}
+	return nil
+}
+
+// classifyError wraps err in an *Error whose kind is derived from the SDK
+// error types, the HTTP status code and, as a last resort, the message.
+func classifyError(provider string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	kind, message := errorKind(err)
+	return &Error{Kind: kind, Provider: provider, Message: message, Err: err, RetryAfter: retryAfter(err)}
+}
+
+func errorKind(err error) (ErrorKind, string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout, "the request timed out"
+	}
+
+	// Gemini
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return ErrContentFiltered, geminiBlockMessage(blocked)
+	}
+	var googleErr *apierror.APIError
+	if errors.As(err, &googleErr) {
+		if strings.Contains(googleErr.Error(), "API key not valid") {
+			return ErrAuth, "the API key is not valid"
+		}
+		if googleErr.HTTPCode() > 0 {
+			return statusKind(googleErr.HTTPCode(), "")
+		}
+	}
+
+	// OpenAI
+	var openAIErr *openai.APIError
+	if errors.As(err, &openAIErr) {
+		code, _ := openAIErr.Code.(string)
+		return statusKind(openAIErr.HTTPStatusCode, code)
+	}
+	var openAIRequestErr *openai.RequestError
+	if errors.As(err, &openAIRequestErr) {
+		return statusKind(openAIRequestErr.HTTPStatusCode, "")
+	}
+
+	// Azure OpenAI
+	var azureErr *azcore.ResponseError
+	if errors.As(err, &azureErr) {
+		return statusKind(azureErr.StatusCode, azureErr.ErrorCode)
+	}
+
+	// Amazon Bedrock
+	var awsErr smithy.APIError
+	if errors.As(err, &awsErr) {
+		switch awsErr.ErrorCode() {
+		case "ThrottlingException":
+			return ErrRateLimit, "the request was throttled"
+		case "ServiceQuotaExceededException":
+			return ErrQuota, "the service quota is exceeded"
+		case "AccessDeniedException":
+			return ErrAuth, "access denied. Make sure the AWS profile may invoke the model and the model access is enabled"
+		case "UnrecognizedClientException", "ExpiredTokenException", "InvalidSignatureException":
+			return ErrAuth, "the AWS credentials are invalid or expired"
+		case "ResourceNotFoundException":
+			return ErrModelNotFound, "the model does not exist in this region"
+		case "ModelTimeoutException":
+			return ErrTimeout, "the model took too long to respond"
+		case "ValidationException":
+			if strings.Contains(awsErr.ErrorMessage(), "model identifier") {
+				return ErrModelNotFound, "the model identifier is invalid"
+			}
+		}
+	}
+	var awsResponseErr *awshttp.ResponseError
+	if errors.As(err, &awsResponseErr) {
+		return statusKind(awsResponseErr.HTTPStatusCode(), "")
+	}
+
+	// Ollama
+	var ollamaErr *OllamaError
+	if errors.As(err, &ollamaErr) {
+		return statusKind(ollamaErr.StatusCode, "")
+	}
+
+	// Anthropic
+	var anthropicErr *AnthropicError
+	if errors.As(err, &anthropicErr) {
+		return statusKind(anthropicErr.StatusCode, anthropicErr.Type)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrTimeout, "the request timed out"
+		}
+		return ErrNetwork, "could not reach the service"
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrNetwork, "could not resolve the service host"
+	}
+
+	return ErrUnknown, ""
+}
+
+// statusKind maps an HTTP status and an optional service error code to a kind.
+func statusKind(status int, code string) (ErrorKind, string) {
+	switch {
+	case code == "insufficient_quota":
+		return ErrQuota, "the account has run out of quota. Check the plan and billing details"
+	case code == "content_filter" || code == "content_policy_violation":
+		return ErrContentFiltered, "the request was rejected by the content filter"
+	case code == "model_not_found" || code == "DeploymentNotFound":
+		return ErrModelNotFound, "the model or deployment does not exist"
+	case code == "invalid_api_key" || code == "authentication_error":
+		return ErrAuth, "the API key is not valid"
+	case code == "permission_error":
+		return ErrAuth, "the API key may not use this resource"
+	case code == "not_found_error":
+		return ErrModelNotFound, "the model was not found"
+	case code == "rate_limit_error":
+		return ErrRateLimit, "too many requests"
+	case code == "overloaded_error":
+		return ErrNetwork, "the service is overloaded"
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth, "the credentials were rejected"
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimit, "too many requests"
+	case status == http.StatusNotFound:
+		return ErrModelNotFound, "the model or endpoint was not found"
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrTimeout, "the request timed out"
+	case status >= 500:
+		return ErrNetwork, fmt.Sprintf("the service is unavailable (status %d)", status)
+	}
+	return ErrUnknown, ""
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/smithy-go"
+	"github.com/google/generative-ai-go/genai"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestClassifyError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err  error
+		want ErrorKind
+	}{
+		"openAI 401":                 {err: &openai.APIError{HTTPStatusCode: 401}, want: ErrAuth},
+		"openAI invalid key":         {err: &openai.APIError{HTTPStatusCode: 400, Code: "invalid_api_key"}, want: ErrAuth},
+		"openAI 429":                 {err: &openai.APIError{HTTPStatusCode: 429}, want: ErrRateLimit},
+		"openAI insufficient quota":  {err: &openai.APIError{HTTPStatusCode: 429, Code: "insufficient_quota"}, want: ErrQuota},
+		"openAI model not found":     {err: &openai.APIError{HTTPStatusCode: 404, Code: "model_not_found"}, want: ErrModelNotFound},
+		"openAI content filter":      {err: &openai.APIError{HTTPStatusCode: 400, Code: "content_filter"}, want: ErrContentFiltered},
+		"openAI 500":                 {err: &openai.APIError{HTTPStatusCode: 500}, want: ErrNetwork},
+		"openAI 400":                 {err: &openai.APIError{HTTPStatusCode: 400}, want: ErrUnknown},
+		"openAI request 503":         {err: &openai.RequestError{HTTPStatusCode: 503}, want: ErrNetwork},
+		"openAI request 408":         {err: &openai.RequestError{HTTPStatusCode: 408}, want: ErrTimeout},
+		"azure deployment not found": {err: &azcore.ResponseError{StatusCode: 404, ErrorCode: "DeploymentNotFound"}, want: ErrModelNotFound},
+		"azure 403":                  {err: &azcore.ResponseError{StatusCode: 403}, want: ErrAuth},
+		"azure 504":                  {err: &azcore.ResponseError{StatusCode: 504}, want: ErrTimeout},
+		"bedrock throttling":         {err: &smithy.GenericAPIError{Code: "ThrottlingException"}, want: ErrRateLimit},
+		"bedrock quota":              {err: &smithy.GenericAPIError{Code: "ServiceQuotaExceededException"}, want: ErrQuota},
+		"bedrock access denied":      {err: &smithy.GenericAPIError{Code: "AccessDeniedException"}, want: ErrAuth},
+		"bedrock expired token":      {err: &smithy.GenericAPIError{Code: "ExpiredTokenException"}, want: ErrAuth},
+		"bedrock unknown model":      {err: &smithy.GenericAPIError{Code: "ResourceNotFoundException"}, want: ErrModelNotFound},
+		"bedrock model timeout":      {err: &smithy.GenericAPIError{Code: "ModelTimeoutException"}, want: ErrTimeout},
+		"bedrock invalid model id":   {err: &smithy.GenericAPIError{Code: "ValidationException", Message: "The provided model identifier is invalid."}, want: ErrModelNotFound},
+		"bedrock validation":         {err: &smithy.GenericAPIError{Code: "ValidationException", Message: "bad input"}, want: ErrUnknown},
+		"gemini blocked":             {err: &genai.BlockedError{PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonSafety}}, want: ErrContentFiltered},
+		"ollama 404":                 {err: &OllamaError{StatusCode: 404}, want: ErrModelNotFound},
+		"ollama 500":                 {err: &OllamaError{StatusCode: 500}, want: ErrNetwork},
+		"anthropic overloaded":       {err: &AnthropicError{StatusCode: 529, Type: "overloaded_error"}, want: ErrNetwork},
+		"anthropic authentication":   {err: &AnthropicError{StatusCode: 401, Type: "authentication_error"}, want: ErrAuth},
+		"anthropic rate limit":       {err: &AnthropicError{StatusCode: 429, Type: "rate_limit_error"}, want: ErrRateLimit},
+		"deadline":                   {err: fmt.Errorf("calling: %w", context.DeadlineExceeded), want: ErrTimeout},
+		"dns":                        {err: &net.DNSError{Err: "no such host", Name: "api.example.com"}, want: ErrNetwork},
+		"dns timeout":                {err: &net.DNSError{Err: "timeout", IsTimeout: true}, want: ErrTimeout},
+		"unknown":                    {err: errors.New("boom"), want: ErrUnknown},
+		"already classified":         {err: &Error{Kind: ErrQuota}, want: ErrQuota},
+	} {
+		err := classifyError("test", tc.err)
+		if got := KindOf(err); got != tc.want {
+			t.Errorf("%s: got %s, want %s", name, got, tc.want)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: the classified error doesn't wrap the original one", name)
+		}
+	}
+
+	if classifyError("test", nil) != nil {
+		t.Error("a nil error was classified")
+	}
+}
@@ -2,66 +2,222 @@ package llm
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"strings"
 
 	"github.com/google/generative-ai-go/genai"
-	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-
 type GeminiProvider struct{}
 
-func (_ GeminiProvider) Chat(userQuery string, verbose bool) (string, error) {
-	ctx := context.Background()
-
-    geminiConfig := viper.Sub("gemini")
+func (_ GeminiProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	geminiConfig := Config("gemini")
 
 	apiKey := geminiConfig.GetString("apiKey")
-    modelName := geminiConfig.GetString("modelName")
-    temperature := float32(geminiConfig.GetFloat64("temperature"))
-    maxOutputTokens := geminiConfig.GetInt32("maxOutputTokens")
+	modelName := req.Options.model(geminiConfig.GetString("modelName"))
+
+	if err := requireSetting("gemini", "apiKey", apiKey); err != nil {
+		return ChatResponse{}, err
+	}
+	if err := requireVision("gemini", "gemini", modelName, req); err != nil {
+		return ChatResponse{}, err
+	}
 
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
-		log.Fatal(err)
-		return "", errors.New("Gemini API Initialized failed")
+		return ChatResponse{}, &Error{Kind: ErrBadConfig, Provider: "gemini", Message: "initializing the Gemini client failed", Err: err}
 	}
 
 	defer client.Close()
 
-    if verbose {
-      fmt.Println("\033[33mModel Params:\033[0m")
-      fmt.Println("\033[36mModel Name: ", modelName)
-      fmt.Println("Temperature: ", temperature)
-      fmt.Println("Max Output Tokens: ", maxOutputTokens)
-      fmt.Println("\033[0m")
-    }
-
 	model := client.GenerativeModel(modelName)
+	configureGemini(model, geminiConfig, req)
+
+	if req.Options.Verbose {
+		fmt.Println("\033[33mModel Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", modelName)
+		if model.Temperature != nil {
+			fmt.Println("Temperature: ", *model.Temperature)
+		}
+		if model.MaxOutputTokens != nil {
+			fmt.Println("Max Output Tokens: ", *model.MaxOutputTokens)
+		}
+		fmt.Println("\033[0m")
+	}
 
-	model.SetTemperature(temperature)
-	model.SetMaxOutputTokens(maxOutputTokens)
+	// Replay every turn but the last as chat history, then send the last one.
+	turns := req.Turns()
+	if len(turns) == 0 {
+		return ChatResponse{}, &Error{Kind: ErrBadConfig, Provider: "gemini", Message: "no messages to send"}
+	}
+	session := model.StartChat()
+	for _, m := range turns[:len(turns)-1] {
+		session.History = append(session.History, geminiContent(m))
+	}
+
+	lastTurn := geminiContent(turns[len(turns)-1]).Parts
+	if req.Stream != nil {
+		return geminiStream(session.SendMessageStream(ctx, lastTurn...), req.Stream)
+	}
 
-	resp, err := model.GenerateContent(ctx, genai.Text(userQuery))
+	resp, err := session.SendMessage(ctx, lastTurn...)
 	if err != nil {
-		log.Fatal(err)
-		return "", err
+		return ChatResponse{}, classifyError("gemini", err)
+	}
+
+	return geminiResponse(resp)
+}
+
+// configureGemini sets the generation options of the model. Unset options
+// are left out, so the model's own defaults apply.
+func configureGemini(model *genai.GenerativeModel, geminiConfig ProviderConfig, req ChatRequest) {
+	if maxOutputTokens := req.Options.maxTokens(geminiConfig.GetInt("maxOutputTokens")); maxOutputTokens > 0 {
+		model.SetMaxOutputTokens(int32(maxOutputTokens))
+	}
+	if req.Options.Temperature != nil || geminiConfig.IsSet("temperature") {
+		model.SetTemperature(float32(req.Options.temperature(geminiConfig.GetFloat64("temperature"))))
+	}
+	if req.Options.TopP != nil || geminiConfig.IsSet("topP") {
+		model.SetTopP(float32(req.Options.topP(geminiConfig.GetFloat64("topP"))))
+	}
+	if req.Schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiSchema(req.Schema.decoded())
+	}
+	if system := req.SystemPrompt(); system != "" {
+		model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(system)}}
+	}
+}
+
+// geminiResponse returns the text of every part of every candidate. A
+// response without any text is an error telling why the model stopped.
+func geminiResponse(resp *genai.GenerateContentResponse) (ChatResponse, error) {
+	if len(resp.Candidates) == 0 {
+		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+			return ChatResponse{}, classifyError("gemini", &genai.BlockedError{PromptFeedback: resp.PromptFeedback})
+		}
+		return ChatResponse{}, &Error{Provider: "gemini", Message: "the model returned no candidates"}
 	}
 
-	content := resp.Candidates[0].Content
+	var response ChatResponse
+	var texts []string
+	var blocked *genai.Candidate
+	for _, candidate := range resp.Candidates {
+		response.FinishReason = candidate.FinishReason.String()
+		if text := geminiText(candidate); text != "" {
+			texts = append(texts, text)
+		}
+		if candidate.FinishReason == genai.FinishReasonSafety || candidate.FinishReason == genai.FinishReasonRecitation {
+			blocked = candidate
+		}
+	}
+	if len(texts) == 0 {
+		// The SDK reports most blocked candidates itself, this covers the streamed ones.
+		if blocked != nil {
+			return ChatResponse{}, classifyError("gemini", &genai.BlockedError{Candidate: blocked})
+		}
+		return ChatResponse{}, &Error{Provider: "gemini", Message: fmt.Sprintf("the model returned no text (finish reason: %s)", response.FinishReason)}
+	}
+	response.Text = strings.Join(texts, "\n\n")
+	response.Usage = geminiUsage(resp.UsageMetadata)
+	return response, nil
+}
 
-	outputResponse := ""
-	if content != nil {
-		r := content.Parts[0]
-		rb, _ := json.MarshalIndent(r, "", "  ")
-		outputResponse = string(rb)
+func geminiUsage(usage *genai.UsageMetadata) Usage {
+	if usage == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     int(usage.PromptTokenCount),
+		CompletionTokens: int(usage.CandidatesTokenCount),
+		TotalTokens:      int(usage.TotalTokenCount),
+	}
+}
+
+// geminiText concatenates the text parts of a candidate.
+func geminiText(candidate *genai.Candidate) string {
+	if candidate.Content == nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		if chunk, ok := part.(genai.Text); ok {
+			text.WriteString(string(chunk))
+		}
+	}
+	return text.String()
+}
+
+// geminiBlockMessage explains why Gemini blocked the prompt or the response,
+// naming the safety categories that triggered it.
+func geminiBlockMessage(blocked *genai.BlockedError) string {
+	var message string
+	var ratings []*genai.SafetyRating
+	if blocked.PromptFeedback != nil {
+		message = fmt.Sprintf("the prompt was blocked (block reason: %s)", blocked.PromptFeedback.BlockReason)
+		ratings = blocked.PromptFeedback.SafetyRatings
+	} else if blocked.Candidate != nil {
+		message = fmt.Sprintf("the response was blocked (finish reason: %s)", blocked.Candidate.FinishReason)
+		ratings = blocked.Candidate.SafetyRatings
 	} else {
-		outputResponse = "Failed to generate message. Try again"
+		return "the response was blocked by the safety filters"
+	}
+
+	var categories []string
+	for _, rating := range ratings {
+		if rating.Blocked {
+			categories = append(categories, rating.Category.String())
+		}
+	}
+	if len(categories) > 0 {
+		message += ", triggered by " + strings.Join(categories, ", ")
+	}
+	return message
+}
+
+// geminiContent converts a message to the Gemini content format, which calls
+// the assistant role "model".
+func geminiContent(m Message) *genai.Content {
+	role := "user"
+	if m.Role == RoleAssistant {
+		role = "model"
+	}
+	parts := []genai.Part{genai.Text(m.Content)}
+	for _, image := range m.Images {
+		parts = append(parts, genai.ImageData(image.format(), image.Data))
 	}
+	return &genai.Content{Role: role, Parts: parts}
+}
 
-	return outputResponse, nil
+func geminiStream(iter *genai.GenerateContentResponseIterator, onChunk StreamFunc) (ChatResponse, error) {
+	var response ChatResponse
+	var text strings.Builder
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return ChatResponse{}, classifyError("gemini", err)
+		}
+		// Every chunk reports the usage so far, the last one the total.
+		if resp.UsageMetadata != nil {
+			response.Usage = geminiUsage(resp.UsageMetadata)
+		}
+		for _, candidate := range resp.Candidates {
+			response.FinishReason = candidate.FinishReason.String()
+			chunk := geminiText(candidate)
+			if chunk == "" {
+				continue
+			}
+			text.WriteString(chunk)
+			if err := onChunk(chunk); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+	}
+	response.Text = text.String()
+	return response, nil
 }
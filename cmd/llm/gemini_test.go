@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestGeminiResponse(t *testing.T) {
+	resp := &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{
+			{Content: &genai.Content{Parts: []genai.Part{genai.Text("Hello, "), genai.Text("world")}}, FinishReason: genai.FinishReasonStop},
+			{Content: &genai.Content{Parts: []genai.Part{genai.Text("Bye")}}, FinishReason: genai.FinishReasonMaxTokens},
+		},
+		UsageMetadata: &genai.UsageMetadata{PromptTokenCount: 3, CandidatesTokenCount: 5, TotalTokenCount: 8},
+	}
+
+	got, err := geminiResponse(resp)
+	if err != nil {
+		t.Fatalf("geminiResponse() error = %v", err)
+	}
+	if got.Text != "Hello, world\n\nBye" {
+		t.Errorf("Text = %q", got.Text)
+	}
+	if got.FinishReason != genai.FinishReasonMaxTokens.String() {
+		t.Errorf("FinishReason = %q", got.FinishReason)
+	}
+	if got.Usage != (Usage{PromptTokens: 3, CompletionTokens: 5, TotalTokens: 8}) {
+		t.Errorf("Usage = %+v", got.Usage)
+	}
+}
+
+func TestGeminiResponseErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		resp    *genai.GenerateContentResponse
+		kind    ErrorKind
+		message []string
+	}{
+		"blocked prompt": {
+			resp: &genai.GenerateContentResponse{PromptFeedback: &genai.PromptFeedback{
+				BlockReason: genai.BlockReasonSafety,
+				SafetyRatings: []*genai.SafetyRating{
+					{Category: genai.HarmCategoryHarassment, Blocked: true},
+					{Category: genai.HarmCategoryHateSpeech},
+				},
+			}},
+			kind:    ErrContentFiltered,
+			message: []string{"the prompt was blocked", genai.BlockReasonSafety.String(), "triggered by " + genai.HarmCategoryHarassment.String()},
+		},
+		"no candidates": {
+			resp:    &genai.GenerateContentResponse{},
+			kind:    ErrUnknown,
+			message: []string{"no candidates"},
+		},
+		"safety finish": {
+			resp: &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+				FinishReason:  genai.FinishReasonSafety,
+				SafetyRatings: []*genai.SafetyRating{{Category: genai.HarmCategoryDangerousContent, Blocked: true}},
+			}}},
+			kind:    ErrContentFiltered,
+			message: []string{"the response was blocked", genai.FinishReasonSafety.String(), genai.HarmCategoryDangerousContent.String()},
+		},
+		"recitation finish": {
+			resp:    &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonRecitation}}},
+			kind:    ErrContentFiltered,
+			message: []string{"the response was blocked", genai.FinishReasonRecitation.String()},
+		},
+		"empty candidate": {
+			resp:    &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{Content: &genai.Content{}, FinishReason: genai.FinishReasonStop}}},
+			kind:    ErrUnknown,
+			message: []string{"no text", genai.FinishReasonStop.String()},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := geminiResponse(tc.resp)
+			var llmErr *Error
+			if !errors.As(err, &llmErr) {
+				t.Fatalf("geminiResponse() error = %v, want *Error", err)
+			}
+			if llmErr.Kind != tc.kind {
+				t.Errorf("Kind = %v, want %v", llmErr.Kind, tc.kind)
+			}
+			if llmErr.Provider != "gemini" {
+				t.Errorf("Provider = %q", llmErr.Provider)
+			}
+			for _, want := range tc.message {
+				if !strings.Contains(llmErr.Message, want) {
+					t.Errorf("Message = %q, want it to contain %q", llmErr.Message, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGeminiBlockMessage(t *testing.T) {
+	if got := geminiBlockMessage(&genai.BlockedError{}); got != "the response was blocked by the safety filters" {
+		t.Errorf("geminiBlockMessage() = %q", got)
+	}
+	got := geminiBlockMessage(&genai.BlockedError{PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonOther}})
+	if strings.Contains(got, "triggered by") {
+		t.Errorf("geminiBlockMessage() = %q, want no categories without blocked ratings", got)
+	}
+}
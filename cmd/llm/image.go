@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImageRequest is everything an image provider needs to generate images.
+// Zero values mean "use the default of the model".
+type ImageRequest struct {
+	Prompt string
+	// NegativePrompt describes what the images must not show.
+	NegativePrompt string
+	// Model overrides the imageModel of the provider section.
+	Model string
+	// N is the number of images to generate, 1 when zero.
+	N int
+	// Size is the size of the images as WIDTHxHEIGHT, e.g. 1024x1024.
+	Size    string
+	Quality string
+	// CfgScale is how strictly the images follow the prompt.
+	CfgScale *float64
+	Seed     *int64
+	Verbose  bool
+}
+
+// GeneratedImage is an image returned by an image provider.
+type GeneratedImage struct {
+	Image
+	// RevisedPrompt is the prompt the model actually used, when it rewrote it.
+	RevisedPrompt string
+}
+
+// ImageProvider is implemented by the backends that generate images.
+type ImageProvider interface {
+	GenerateImages(ctx context.Context, req ImageRequest) ([]GeneratedImage, error)
+}
+
+func (r ImageRequest) n() int {
+	if r.N > 0 {
+		return r.N
+	}
+	return 1
+}
+
+// dimensions parses Size. It returns zeros when Size is empty.
+func (r ImageRequest) dimensions() (width int, height int, err error) {
+	if r.Size == "" {
+		return 0, 0, nil
+	}
+	w, h, ok := strings.Cut(strings.ToLower(r.Size), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid image size %q. Use WIDTHxHEIGHT, e.g. 1024x1024", r.Size)
+	}
+	return width, height, nil
+}
+
+// rejectUnsupported returns an error naming the optional settings of the request
+// that the model can't honor, so that they are not silently ignored. The
+// supported ones are among negativePrompt, size, quality, cfgScale and seed.
+func (r ImageRequest) rejectUnsupported(provider string, model string, supported ...string) error {
+	var names []string
+	for name, set := range map[string]bool{
+		"negativePrompt": r.NegativePrompt != "",
+		"size":           r.Size != "",
+		"quality":        r.Quality != "",
+		"cfgScale":       r.CfgScale != nil,
+		"seed":           r.Seed != nil,
+	} {
+		if set && !slices.Contains(supported, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return ConfigError(provider, "%s doesn't support the %s setting(s)", model, strings.Join(names, ", "))
+}
+
+// decodeImage decodes a base64 encoded image, telling its type from its content.
+func decodeImage(provider string, encoded string) (Image, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Image{}, &Error{Provider: provider, Message: "the model returned an image that is not valid base64", Err: err}
+	}
+	return Image{MIMEType: http.DetectContentType(data), Data: data}, nil
+}
+
+// Extension returns the file extension matching the image type, e.g. .png.
+func (i Image) Extension() string {
+	switch i.MIMEType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	}
+	return ".png"
+}
+
+// decodeImages decodes the base64 encoded images returned by a model.
+func decodeImages(provider string, encoded []string) ([]GeneratedImage, error) {
+	if len(encoded) == 0 {
+		return nil, &Error{Provider: provider, Message: "the model returned no image"}
+	}
+	images := make([]GeneratedImage, 0, len(encoded))
+	for _, e := range encoded {
+		image, err := decodeImage(provider, e)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, GeneratedImage{Image: image})
+	}
+	return images, nil
+}
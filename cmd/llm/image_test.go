@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// onePixelPNG is a valid 1x1 PNG image.
+const onePixelPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+func TestOpenAIProviderGenerateImages(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/generations" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"created": 1,
+			"data": []map[string]string{
+				{"b64_json": onePixelPNG, "revised_prompt": "a red fox in the snow"},
+				{"b64_json": onePixelPNG},
+			},
+		})
+	}))
+	defer server.Close()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("endpoints.local.baseURL", server.URL)
+	viper.Set("endpoints.local.imageModel", "sdxl")
+
+	images, err := NewOpenAICompatibleProvider("local").GenerateImages(context.Background(), ImageRequest{
+		Prompt: "a fox",
+		N:      2,
+		Size:   "512x512",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got["model"] != "sdxl" || got["n"] != float64(2) || got["size"] != "512x512" || got["response_format"] != "b64_json" {
+		t.Errorf("unexpected request %v", got)
+	}
+	want, _ := base64.StdEncoding.DecodeString(onePixelPNG)
+	if len(images) != 2 || string(images[0].Data) != string(want) || images[0].MIMEType != "image/png" || images[0].Extension() != ".png" {
+		t.Fatalf("unexpected images %+v", images)
+	}
+	if images[0].RevisedPrompt != "a red fox in the snow" {
+		t.Errorf("unexpected revised prompt %q", images[0].RevisedPrompt)
+	}
+}
+
+func TestImageRequestRejectUnsupported(t *testing.T) {
+	seed := int64(7)
+	req := ImageRequest{Prompt: "a fox", NegativePrompt: "people", Seed: &seed, Size: "1024x1024"}
+
+	err := req.rejectUnsupported("openAI", "dall-e-3", "size", "quality")
+	if KindOf(err) != ErrBadConfig || err.Error() != "openAI: dall-e-3 doesn't support the negativePrompt, seed setting(s)" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := req.rejectUnsupported("bedrock", "amazon.titan-image-generator-v1", "negativePrompt", "size", "seed"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestImageRequestDimensions(t *testing.T) {
+	for size, want := range map[string][2]int{"": {0, 0}, "1024x768": {1024, 768}, "512X512": {512, 512}} {
+		width, height, err := ImageRequest{Size: size}.dimensions()
+		if err != nil || width != want[0] || height != want[1] {
+			t.Errorf("dimensions of %q = %d, %d, %v", size, width, height, err)
+		}
+	}
+	for _, size := range []string{"1024", "x512", "0x512", "big"} {
+		if _, _, err := (ImageRequest{Size: size}).dimensions(); err == nil {
+			t.Errorf("dimensions of %q: expected an error", size)
+		}
+	}
+}
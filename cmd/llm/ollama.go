@@ -0,0 +1,391 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const OLLAMA_DEFAULT_HOST = "http://localhost:11434"
+
+type OllamaProvider struct{}
+
+func (_ OllamaProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	ollamaConfig := Config("ollama")
+
+	host := ollamaConfig.GetString("host")
+	modelName := req.Options.model(ollamaConfig.GetString("modelName"))
+	contextSize := ollamaConfig.GetInt("contextSize")
+	maxOutputTokens := req.Options.maxTokens(ollamaConfig.GetInt("maxOutputTokens"))
+
+	if modelName == "" {
+		return ChatResponse{}, ConfigError("ollama", "no Ollama model configured. Set ollama.modelName in the config file")
+	}
+	if err := requireVision("ollama", "ollama", modelName, req); err != nil {
+		return ChatResponse{}, err
+	}
+
+	// Unset options are left out, so the model's own defaults apply.
+	options := OllamaOptions{
+		NumCtx:     contextSize,
+		NumPredict: maxOutputTokens,
+	}
+	if req.Options.Temperature != nil || ollamaConfig.IsSet("temperature") {
+		temperature := req.Options.temperature(ollamaConfig.GetFloat64("temperature"))
+		options.Temperature = &temperature
+	}
+	if req.Options.TopP != nil || ollamaConfig.IsSet("topP") {
+		topP := req.Options.topP(ollamaConfig.GetFloat64("topP"))
+		options.TopP = &topP
+	}
+
+	if req.Options.Verbose {
+		fmt.Println("\033[33mModel Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", modelName)
+		fmt.Println("Host: ", host)
+		if options.Temperature != nil {
+			fmt.Println("Temperature: ", *options.Temperature)
+		}
+		fmt.Println("Context Size: ", contextSize)
+		fmt.Println("\033[0m")
+	}
+
+	client := NewOllamaClient(host)
+	chatRequest := OllamaChatRequest{
+		Model:    modelName,
+		Messages: ollamaMessages(req.Messages),
+		Options:  options,
+	}
+	if req.Schema != nil {
+		chatRequest.Format = req.Schema.Definition
+	}
+
+	var chatResponse OllamaChatResponse
+	var text strings.Builder
+	var err error
+	if req.Stream != nil {
+		chatResponse, err = client.ChatStream(ctx, chatRequest, func(part OllamaChatResponse) error {
+			if part.Message.Content == "" {
+				return nil
+			}
+			text.WriteString(part.Message.Content)
+			return req.Stream(part.Message.Content)
+		})
+		chatResponse.Message.Content = text.String()
+	} else {
+		chatResponse, err = client.Chat(ctx, chatRequest)
+	}
+
+	// Ollama releases before /api/chat existed only understand /api/generate.
+	var apiErr *OllamaError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && apiErr.Message == "" {
+		generateResponse, err := client.Generate(ctx, OllamaGenerateRequest{
+			Model:   modelName,
+			Prompt:  flatPrompt(ChatRequest{Messages: req.Turns()}),
+			System:  req.SystemPrompt(),
+			Images:  ollamaImages(req.Messages),
+			Options: options,
+		})
+		if err != nil {
+			return ChatResponse{}, classifyError("ollama", client.explain(ctx, modelName, err))
+		}
+		if req.Stream != nil {
+			if err := req.Stream(generateResponse.Response); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+		return generateResponse.chatResponse(generateResponse.Response), nil
+	}
+	if err != nil {
+		return ChatResponse{}, classifyError("ollama", client.explain(ctx, modelName, err))
+	}
+
+	return chatResponse.chatResponse(chatResponse.Message.Content), nil
+}
+
+func ollamaMessages(messages []Message) []OllamaMessage {
+	out := make([]OllamaMessage, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, OllamaMessage{Role: string(m.Role), Content: m.Content, Images: ollamaImages([]Message{m})})
+	}
+	return out
+}
+
+// ollamaImages returns the images of the messages. Ollama takes them as
+// base64 strings, which is how encoding/json encodes byte slices.
+func ollamaImages(messages []Message) [][]byte {
+	var images [][]byte
+	for _, m := range messages {
+		for _, image := range m.Images {
+			images = append(images, image.Data)
+		}
+	}
+	return images
+}
+
+// flatPrompt renders the conversation as plain text for the models that take
+// a single prompt string. A lone user message is passed through untouched.
+func flatPrompt(req ChatRequest) string {
+	turns := req.Turns()
+	system := req.SystemPrompt()
+	if len(turns) == 1 && system == "" {
+		return turns[0].Content
+	}
+
+	var b strings.Builder
+	if system != "" {
+		b.WriteString(system + "\n\n")
+	}
+	for _, m := range turns {
+		if m.Role == RoleAssistant {
+			b.WriteString("Assistant: ")
+		} else {
+			b.WriteString("User: ")
+		}
+		b.WriteString(m.Content + "\n\n")
+	}
+	b.WriteString("Assistant:")
+	return b.String()
+}
+
+// OllamaClient is a minimal client for the Ollama HTTP API.
+// See https://github.com/ollama/ollama/blob/main/docs/api.md
+type OllamaClient struct {
+	Host       string
+	HTTPClient *http.Client
+}
+
+// NewOllamaClient returns a client for the given host, falling back to the
+// default local daemon address when host is empty. Like the ollama CLI it
+// accepts a bare host:port, as found in OLLAMA_HOST.
+func NewOllamaClient(host string) *OllamaClient {
+	if host == "" {
+		host = OLLAMA_DEFAULT_HOST
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return &OllamaClient{
+		Host:       strings.TrimRight(host, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type OllamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  [][]byte `json:"images,omitempty"`
+}
+
+type OllamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	// Format is a JSON Schema the answer must match.
+	Format  json.RawMessage `json:"format,omitempty"`
+	Options OllamaOptions   `json:"options,omitempty"`
+}
+
+type OllamaGenerateRequest struct {
+	Model   string        `json:"model"`
+	Prompt  string        `json:"prompt"`
+	System  string        `json:"system,omitempty"`
+	Images  [][]byte      `json:"images,omitempty"`
+	Stream  bool          `json:"stream"`
+	Options OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaStats holds the fields shared by the final chat and generate responses.
+type OllamaStats struct {
+	Model           string `json:"model"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+type OllamaChatResponse struct {
+	OllamaStats
+	Message OllamaMessage `json:"message"`
+}
+
+type OllamaGenerateResponse struct {
+	OllamaStats
+	Response string `json:"response"`
+}
+
+type OllamaModel struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	Size  int64  `json:"size"`
+}
+
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+// OllamaError is returned when the daemon answers with a non-2xx status.
+// Message is empty when the body was not an Ollama JSON error, e.g. a plain
+// "404 page not found" for an unknown endpoint.
+type OllamaError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *OllamaError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ollama: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("ollama: %s (status %d)", e.Message, e.StatusCode)
+}
+
+func (s OllamaStats) chatResponse(text string) ChatResponse {
+	return ChatResponse{
+		Text:         text,
+		FinishReason: s.DoneReason,
+		Usage: Usage{
+			PromptTokens:     s.PromptEvalCount,
+			CompletionTokens: s.EvalCount,
+			TotalTokens:      s.PromptEvalCount + s.EvalCount,
+		},
+	}
+}
+
+// Chat calls /api/chat with streaming disabled.
+func (c *OllamaClient) Chat(ctx context.Context, req OllamaChatRequest) (OllamaChatResponse, error) {
+	var resp OllamaChatResponse
+	req.Stream = false
+	err := c.do(ctx, http.MethodPost, "/api/chat", req, &resp)
+	return resp, err
+}
+
+// ChatStream calls /api/chat with streaming enabled and passes every partial
+// response to fn. The final response, which carries the stats, is returned.
+func (c *OllamaClient) ChatStream(ctx context.Context, req OllamaChatRequest, fn func(OllamaChatResponse) error) (OllamaChatResponse, error) {
+	req.Stream = true
+	resp, err := c.send(ctx, http.MethodPost, "/api/chat", req)
+	if err != nil {
+		return OllamaChatResponse{}, err
+	}
+	defer resp.Body.Close()
+	return decodeStream(resp.Body, fn)
+}
+
+// Generate calls /api/generate with streaming disabled.
+func (c *OllamaClient) Generate(ctx context.Context, req OllamaGenerateRequest) (OllamaGenerateResponse, error) {
+	var resp OllamaGenerateResponse
+	req.Stream = false
+	err := c.do(ctx, http.MethodPost, "/api/generate", req, &resp)
+	return resp, err
+}
+
+// Tags lists the models available locally.
+func (c *OllamaClient) Tags(ctx context.Context) ([]OllamaModel, error) {
+	var resp OllamaTagsResponse
+	err := c.do(ctx, http.MethodGet, "/api/tags", nil, &resp)
+	return resp.Models, err
+}
+
+func (c *OllamaClient) do(ctx context.Context, method string, path string, body any, out any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return nil
+}
+
+// send performs the request and turns non-2xx answers into an *OllamaError.
+// The caller must close the body of the returned response.
+func (c *OllamaClient) send(ctx context.Context, method string, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.Host+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Ollama at %s. Is `ollama serve` running? %w", c.Host, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		apiErr := &OllamaError{StatusCode: resp.StatusCode}
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		if raw, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(raw, &errBody) == nil {
+			apiErr.Message = errBody.Error
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// decodeStream reads the newline-delimited JSON objects of a streamed answer,
+// passing each to fn, and returns the last one.
+func decodeStream[T any](body io.Reader, fn func(T) error) (T, error) {
+	var last T
+	decoder := json.NewDecoder(body)
+	for {
+		var part T
+		err := decoder.Decode(&part)
+		if err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			return last, fmt.Errorf("failed to unmarshal: %w", err)
+		}
+		if err := fn(part); err != nil {
+			return last, err
+		}
+		last = part
+	}
+}
+
+// explain adds the locally available models to a "model not found" error so
+// the user knows what to pull or pick instead.
+func (c *OllamaClient) explain(ctx context.Context, modelName string, err error) error {
+	var apiErr *OllamaError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	models, tagsErr := c.Tags(ctx)
+	if tagsErr != nil || len(models) == 0 {
+		return fmt.Errorf("%w. Run `ollama pull %s` first", err, modelName)
+	}
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	return fmt.Errorf("%w. Available models: %s", err, strings.Join(names, ", "))
+}
@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func useOllamaConfig(t *testing.T, host string) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("ollama.host", host)
+	viper.Set("ollama.modelName", "llama3")
+	viper.Set("ollama.temperature", 0.2)
+	viper.Set("ollama.contextSize", 4096)
+}
+
+func TestOllamaProviderChat(t *testing.T) {
+	var got OllamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":             "llama3",
+			"message":           map[string]string{"role": "assistant", "content": "Olympia"},
+			"done":              true,
+			"done_reason":       "stop",
+			"prompt_eval_count": 12,
+			"eval_count":        3,
+		})
+	}))
+	defer server.Close()
+	useOllamaConfig(t, server.URL)
+
+	req := ChatRequest{Messages: []Message{
+		{Role: RoleSystem, Content: "Be terse."},
+		{Role: RoleUser, Content: "Capital of Washington?"},
+	}}
+	resp, err := OllamaProvider{}.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Text != "Olympia" || resp.FinishReason != "stop" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 3 || resp.Usage.TotalTokens != 15 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+	if got.Model != "llama3" || got.Stream || len(got.Messages) != 2 || got.Messages[0].Role != "system" {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if got.Options.NumCtx != 4096 || got.Options.Temperature == nil || *got.Options.Temperature != 0.2 {
+		t.Errorf("unexpected options %+v", got.Options)
+	}
+}
+
+func TestOllamaProviderFallsBackToGenerate(t *testing.T) {
+	var got OllamaGenerateRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/generate":
+			json.NewDecoder(r.Body).Decode(&got)
+			json.NewEncoder(w).Encode(map[string]any{"response": "Olympia", "done": true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	useOllamaConfig(t, server.URL)
+
+	resp, err := OllamaProvider{}.Chat(context.Background(), NewChatRequest("Capital of Washington?", Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Olympia" {
+		t.Errorf("got %q, want %q", resp.Text, "Olympia")
+	}
+	if got.Prompt != "Capital of Washington?" {
+		t.Errorf("unexpected prompt %q", got.Prompt)
+	}
+}
+
+func TestOllamaProviderModelNotFoundListsTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			json.NewEncoder(w).Encode(map[string]any{
+				"models": []map[string]any{{"name": "mistral:latest"}, {"name": "phi3:latest"}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": `model "llama3" not found, try pulling it first`})
+		}
+	}))
+	defer server.Close()
+	useOllamaConfig(t, server.URL)
+
+	_, err := OllamaProvider{}.Chat(context.Background(), NewChatRequest("hi", Options{}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "mistral:latest, phi3:latest") {
+		t.Errorf("error does not list available models: %v", err)
+	}
+}
+
+func TestOllamaProviderStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got OllamaChatRequest
+		json.NewDecoder(r.Body).Decode(&got)
+		if !got.Stream {
+			t.Error("expected a streaming request")
+		}
+		encoder := json.NewEncoder(w)
+		for _, word := range []string{"Oly", "mp", "ia"} {
+			encoder.Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": word}})
+		}
+		encoder.Encode(map[string]any{"done": true, "done_reason": "stop", "prompt_eval_count": 5, "eval_count": 3})
+	}))
+	defer server.Close()
+	useOllamaConfig(t, server.URL)
+
+	var chunks []string
+	req := NewChatRequest("Capital of Washington?", Options{})
+	req.Stream = func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}
+	resp, err := OllamaProvider{}.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(chunks, "|") != "Oly|mp|ia" {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+	if resp.Text != "Olympia" || resp.FinishReason != "stop" || resp.Usage.TotalTokens != 8 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestOllamaProviderLeavesUnsetOptionsOut(t *testing.T) {
+	var bodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, body)
+		json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": "ok"}, "done": true})
+	}))
+	defer server.Close()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("ollama.host", server.URL)
+	viper.Set("ollama.modelName", "llama3")
+
+	if _, err := (OllamaProvider{}).Chat(context.Background(), NewChatRequest("Hi", Options{})); err != nil {
+		t.Fatal(err)
+	}
+	zero := 0.0
+	if _, err := (OllamaProvider{}).Chat(context.Background(), NewChatRequest("Hi", Options{Temperature: &zero})); err != nil {
+		t.Fatal(err)
+	}
+
+	options, _ := bodies[0]["options"].(map[string]any)
+	if _, ok := options["temperature"]; ok {
+		t.Errorf("temperature sent without being set: %v", bodies[0]["options"])
+	}
+	options, _ = bodies[1]["options"].(map[string]any)
+	if temperature, ok := options["temperature"]; !ok || temperature != 0.0 {
+		t.Errorf("--temperature 0 not sent: %v", bodies[1]["options"])
+	}
+}
+
+func TestFlatPrompt(t *testing.T) {
+	if got := flatPrompt(NewChatRequest("Hi", Options{})); got != "Hi" {
+		t.Errorf("a lone question was changed: %q", got)
+	}
+
+	req := ChatRequest{Messages: []Message{
+		{Role: RoleSystem, Content: "Be terse."},
+		{Role: RoleUser, Content: "Capital of Washington?"},
+		{Role: RoleAssistant, Content: "Olympia"},
+		{Role: RoleUser, Content: "And of Oregon?"},
+	}}
+	want := "Be terse.\n\nUser: Capital of Washington?\n\nAssistant: Olympia\n\nUser: And of Oregon?\n\nAssistant:"
+	if got := flatPrompt(req); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
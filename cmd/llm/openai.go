@@ -2,66 +2,316 @@ package llm
 
 import (
 	"context"
-    "log"
-    "fmt"
-    "errors"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
 	openai "github.com/sashabaranov/go-openai"
-	"github.com/spf13/viper"
 )
 
-type OpenAIProvider struct{}
-
-func (_ OpenAIProvider) Chat(userQuery string, verbose bool) (string, error) {
-    
-    openAIConfig := viper.Sub("openAI")
-
-  	apiKey := openAIConfig.GetString("apiKey")
-    temperature := openAIConfig.GetFloat64("temperature")
-    modelName := openAIConfig.GetString("modelName")
-    maxOutputTokens := openAIConfig.GetInt32("maxOutputTokens")
-	client := openai.NewClient(apiKey)
-
-    var model string
-
-    switch modelName {
-      case "gpt-3.5-turbo": 
-        model = openai.GPT3Dot5Turbo
-      case "gpt-4-turbo":
-        model = openai.GPT4Turbo
-      case "gpt-4":
-        model = openai.GPT4
-      default:
-        log.Fatal("Unsupported Model. Make sure the model name parsed is correct")
-        return "", errors.New("Unsupported Model name found")
-  }   
-    
-    if verbose {
-      fmt.Println("\033[33mModel Params:\033[0m")
-      fmt.Println("\033[36mModel Name: ", modelName)
-      fmt.Println("Temperature: ", temperature)
-      fmt.Println("Max Output Tokens: ", maxOutputTokens)
-      fmt.Println("\033[0m")
-    }
-  
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: model,
-            Temperature: float32(temperature),
-            MaxTokens: int(maxOutputTokens),
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: userQuery,
-				},
-			},
+// OpenAIProvider talks to the OpenAI API, or to any server speaking the
+// same protocol. The zero value reads the openAI config section; named
+// OpenAI-compatible endpoints set Name and Section.
+type OpenAIProvider struct {
+	// Name is the provider name used in messages, openAI when empty.
+	Name string
+	// Section is the config section holding the settings, the one named after the provider when empty.
+	Section string
+}
+
+// NewOpenAICompatibleProvider returns the provider for the OpenAI-compatible
+// endpoint configured under endpoints.<name>.
+func NewOpenAICompatibleProvider(name string) OpenAIProvider {
+	return OpenAIProvider{Name: name, Section: "endpoints." + name}
+}
+
+func (p OpenAIProvider) name() string {
+	if p.Name == "" {
+		return "openAI"
+	}
+	return p.Name
+}
+
+func (p OpenAIProvider) section() string {
+	if p.Section == "" {
+		return p.name()
+	}
+	return p.Section
+}
+
+func (p OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	name := p.name()
+	openAIConfig := Config(p.section())
+
+	temperature := req.Options.temperature(openAIConfig.GetFloat64("temperature"))
+	modelName := req.Options.model(openAIConfig.GetString("modelName"))
+	maxOutputTokens := req.Options.maxTokens(openAIConfig.GetInt("maxOutputTokens"))
+	clientConfig, err := p.clientConfig()
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	if err := requireSetting(p.section(), "modelName", modelName); err != nil {
+		return ChatResponse{}, err
+	}
+	if err := requireVision(name, p.section(), modelName, req); err != nil {
+		return ChatResponse{}, err
+	}
+
+	client := openai.NewClientWithConfig(clientConfig)
+
+	if req.Options.Verbose {
+		fmt.Println("\033[33mModel Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", modelName)
+		fmt.Println("Base URL: ", clientConfig.BaseURL)
+		fmt.Println("Temperature: ", temperature)
+		fmt.Println("Max Output Tokens: ", maxOutputTokens)
+		fmt.Println("\033[0m")
+	}
+
+	chatRequest := openai.ChatCompletionRequest{
+		Model:    modelName,
+		Messages: openAIMessages(req.Messages),
+	}
+	if reasoningModel(modelName) {
+		// o-series models only accept max_completion_tokens and the default sampling settings.
+		chatRequest.MaxCompletionTokens = maxOutputTokens
+	} else {
+		chatRequest.MaxTokens = maxOutputTokens
+		chatRequest.Temperature = float32(temperature)
+		if req.Options.TopP != nil || openAIConfig.IsSet("topP") {
+			chatRequest.TopP = float32(req.Options.topP(openAIConfig.GetFloat64("topP")))
+		}
+	}
+
+	if req.Schema != nil {
+		chatRequest.ResponseFormat = responseFormat(openAIConfig.GetString("responseFormat"), clientConfig.BaseURL, req.Schema)
+	}
+
+	if req.Stream != nil {
+		// The usage of a streamed answer comes in a last chunk without choices.
+		chatRequest.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+		return openAIStream(ctx, name, client, chatRequest, req.Stream)
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, chatRequest)
+
+	if err != nil {
+		return ChatResponse{}, classifyError(name, err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return ChatResponse{}, &Error{Provider: name, Message: "the model returned no choices"}
+	}
+
+	return ChatResponse{
+		Text:         resp.Choices[0].Message.Content,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
 		},
-	)
+	}, nil
+}
+
+// clientConfig returns the client settings of the section: the API key, base
+// URL, organization and extra headers.
+func (p OpenAIProvider) clientConfig() (openai.ClientConfig, error) {
+	openAIConfig := Config(p.section())
+
+	apiKey := openAIConfig.GetString("apiKey")
+	baseURL := openAIConfig.GetString("baseURL")
+	// Self-hosted OpenAI-compatible servers usually don't check the API key.
+	if baseURL == "" {
+		if err := requireSetting(p.section(), "apiKey", apiKey); err != nil {
+			return openai.ClientConfig{}, err
+		}
+	}
 
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		clientConfig.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	clientConfig.OrgID = openAIConfig.GetString("organization")
+	clientConfig.HTTPClient = &http.Client{Transport: headerTransport{
+		headers: openAIConfig.GetStringMapString("headers"),
+		base:    retryAfterTransport{},
+	}}
+	return clientConfig, nil
+}
+
+// GenerateImages generates images with DALL·E or gpt-image models, or the
+// image model of an OpenAI-compatible endpoint. The model is read from
+// imageModel, dall-e-3 by default.
+func (p OpenAIProvider) GenerateImages(ctx context.Context, req ImageRequest) ([]GeneratedImage, error) {
+	name := p.name()
+	openAIConfig := Config(p.section())
+
+	clientConfig, err := p.clientConfig()
 	if err != nil {
-      log.Fatal(err)
-      return "", errors.New("OpenAI Chat Completion Failed")
+		return nil, err
+	}
+	model := req.Model
+	if model == "" {
+		model = openAIConfig.GetString("imageModel")
+	}
+	if model == "" {
+		model = openai.CreateImageModelDallE3
+	}
+	if err := req.rejectUnsupported(name, model, "size", "quality"); err != nil {
+		return nil, err
+	}
+
+	imageRequest := openai.ImageRequest{
+		Prompt:  req.Prompt,
+		Model:   model,
+		N:       req.n(),
+		Size:    req.Size,
+		Quality: req.Quality,
+	}
+	// gpt-image models always answer with base64 data and reject the parameter.
+	if !strings.HasPrefix(model, "gpt-image") {
+		imageRequest.ResponseFormat = openai.CreateImageResponseFormatB64JSON
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	if req.Verbose {
+		fmt.Println("\033[33mImage Params:\033[0m")
+		fmt.Println("\033[36mModel Name: ", model)
+		fmt.Println("Base URL: ", clientConfig.BaseURL)
+		fmt.Println("Images: ", imageRequest.N)
+		fmt.Println("\033[0m")
+	}
+
+	resp, err := openai.NewClientWithConfig(clientConfig).CreateImage(ctx, imageRequest)
+	if err != nil {
+		return nil, classifyError(name, err)
+	}
+
+	images := make([]GeneratedImage, 0, len(resp.Data))
+	for _, data := range resp.Data {
+		image, err := decodeImage(name, data.B64JSON)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, GeneratedImage{Image: image, RevisedPrompt: data.RevisedPrompt})
+	}
+	return images, nil
+}
+
+func openAIMessages(messages []Message) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, m := range messages {
+		if len(m.Images) == 0 {
+			out = append(out, openai.ChatCompletionMessage{
+				Role:    string(m.Role),
+				Content: m.Content,
+			})
+			continue
+		}
+
+		// Images are only accepted in the multi-part form of the content.
+		parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: m.Content}}
+		for _, image := range m.Images {
+			parts = append(parts, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: image.dataURI()},
+			})
+		}
+		out = append(out, openai.ChatCompletionMessage{
+			Role:         string(m.Role),
+			MultiContent: parts,
+		})
+	}
+	return out
+}
+
+func openAIStream(ctx context.Context, name string, client *openai.Client, chatRequest openai.ChatCompletionRequest, onChunk StreamFunc) (ChatResponse, error) {
+	stream, err := client.CreateChatCompletionStream(ctx, chatRequest)
+	if err != nil {
+		return ChatResponse{}, classifyError(name, err)
+	}
+	defer stream.Close()
+
+	var response ChatResponse
+	var text strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ChatResponse{}, classifyError(name, err)
+		}
+		if chunk.Usage != nil {
+			response.Usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			response.FinishReason = string(choice.FinishReason)
+		}
+		text.WriteString(choice.Delta.Content)
+		if err := onChunk(choice.Delta.Content); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	response.Text = text.String()
+	return response, nil
+}
+
+// responseFormat returns the response format asking for an answer matching
+// the schema, nil to only rely on the instructions. format is jsonSchema,
+// jsonObject or none. When empty, json_schema is used with the OpenAI API and
+// JSON mode with other servers, as many of them reject json_schema.
+func responseFormat(format string, baseURL string, schema *Schema) *openai.ChatCompletionResponseFormat {
+	if format == "" {
+		format = "jsonObject"
+		if u, err := url.Parse(baseURL); err == nil && u.Host == "api.openai.com" {
+			format = "jsonSchema"
+		}
+	}
+	switch format {
+	case "jsonSchema":
+		return &openai.ChatCompletionResponseFormat{
+			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: schema.Name, Schema: schema.Definition},
+		}
+	case "jsonObject":
+		// JSON mode only produces objects.
+		if schema.object() {
+			return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		}
+	}
+	return nil
+}
+
+// reasoningModel reports whether the model is one of the OpenAI o-series
+// reasoning models, e.g. o1-mini or o3.
+func reasoningModel(model string) bool {
+	return len(model) > 1 && model[0] == 'o' && model[1] >= '0' && model[1] <= '9'
+}
+
+// headerTransport is an http.RoundTripper adding the configured extra headers to every request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) > 0 {
+		req = req.Clone(req.Context())
+		for key, value := range t.headers {
+			req.Header.Set(key, value)
+		}
+	}
+	return t.base.RoundTrip(req)
 }
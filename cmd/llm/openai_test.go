@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/viper"
+)
+
+func TestOpenAICompatibleProviderChat(t *testing.T) {
+	var got map[string]any
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		headers = r.Header
+		got = nil
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "Olympia"}, "finish_reason": "stop"}},
+			"usage":   map[string]int{"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15},
+		})
+	}))
+	defer server.Close()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	// The trailing slash of the base URL is dropped.
+	viper.Set("endpoints.local.baseURL", server.URL+"/v1/")
+	viper.Set("endpoints.local.apiKey", "sk-local")
+	viper.Set("endpoints.local.organization", "org-1")
+	viper.Set("endpoints.local.headers", map[string]string{"X-Title": "gq"})
+	viper.Set("endpoints.local.modelName", "qwen2.5")
+	viper.Set("endpoints.local.temperature", 0.4)
+	viper.Set("endpoints.local.maxOutputTokens", 256)
+
+	provider := NewOpenAICompatibleProvider("local")
+	resp, err := provider.Chat(context.Background(), NewChatRequest("Capital of Washington?", Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Olympia" || resp.FinishReason != "stop" || resp.Usage.TotalTokens != 15 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if headers.Get("Authorization") != "Bearer sk-local" || headers.Get("OpenAI-Organization") != "org-1" || headers.Get("X-Title") != "gq" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+	if got["model"] != "qwen2.5" || got["max_tokens"] != float64(256) || got["temperature"].(float64) < 0.39 || got["max_completion_tokens"] != nil {
+		t.Errorf("unexpected request %v", got)
+	}
+
+	// o-series models take max_completion_tokens and no sampling settings.
+	if _, err := provider.Chat(context.Background(), NewChatRequest("Hi", Options{Model: "o3-mini"})); err != nil {
+		t.Fatal(err)
+	}
+	if got["model"] != "o3-mini" || got["max_completion_tokens"] != float64(256) || got["max_tokens"] != nil || got["temperature"] != nil {
+		t.Errorf("unexpected o-series request %v", got)
+	}
+
+	// Compatible servers get JSON mode for --schema unless told otherwise.
+	schema, err := NewSchema("repo", []byte(repoSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := NewChatRequest("Describe gq", Options{})
+	req.Schema = schema
+	if _, err := provider.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if format, _ := got["response_format"].(map[string]any); format["type"] != "json_object" {
+		t.Errorf("unexpected response format %v", got["response_format"])
+	}
+	viper.Set("endpoints.local.responseFormat", "jsonSchema")
+	if _, err := provider.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if format, _ := got["response_format"].(map[string]any); format["type"] != "json_schema" {
+		t.Errorf("unexpected response format %v", got["response_format"])
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	object, _ := NewSchema("repo", []byte(repoSchema))
+	list, _ := NewSchema("names", []byte(`{"type": "array", "items": {"type": "string"}}`))
+
+	for _, tc := range []struct {
+		format  string
+		baseURL string
+		schema  *Schema
+		want    openai.ChatCompletionResponseFormatType
+	}{
+		{baseURL: "https://api.openai.com/v1", schema: object, want: openai.ChatCompletionResponseFormatTypeJSONSchema},
+		{baseURL: "https://api.openai.com/v1", schema: list, want: openai.ChatCompletionResponseFormatTypeJSONSchema},
+		{baseURL: "http://localhost:8000/v1", schema: object, want: openai.ChatCompletionResponseFormatTypeJSONObject},
+		{baseURL: "https://api.groq.com/openai/v1", schema: list, want: ""},
+		{format: "jsonSchema", baseURL: "http://localhost:8000/v1", schema: object, want: openai.ChatCompletionResponseFormatTypeJSONSchema},
+		{format: "jsonObject", baseURL: "https://api.openai.com/v1", schema: object, want: openai.ChatCompletionResponseFormatTypeJSONObject},
+		{format: "none", baseURL: "https://api.openai.com/v1", schema: object, want: ""},
+	} {
+		var got openai.ChatCompletionResponseFormatType
+		if format := responseFormat(tc.format, tc.baseURL, tc.schema); format != nil {
+			got = format.Type
+		}
+		if got != tc.want {
+			t.Errorf("%q with %s and the %s schema: got %q, want %q", tc.format, tc.baseURL, tc.schema.Name, got, tc.want)
+		}
+	}
+}
+
+func TestReasoningModel(t *testing.T) {
+	for model, want := range map[string]bool{
+		"o1":                     true,
+		"o1-mini":                true,
+		"o3-mini":                true,
+		"o4-mini":                true,
+		"gpt-4o":                 false,
+		"gpt-4o-mini":            false,
+		"omni-moderation-latest": false,
+		"o":                      false,
+		"":                       false,
+	} {
+		if got := reasoningModel(model); got != want {
+			t.Errorf("%s: got %v, want %v", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/googleapis/gax-go/v2/apierror"
+)
+
+// RetryPolicy controls how calls failing with a transient error are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made before giving up, the first one included.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles on every retry, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is used when retry.maxAttempts is not set.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// backoff returns the delay before the given retry, counting from 1. It uses
+// full jitter so that concurrent callers don't retry in lockstep.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// retryingProvider retries the calls of a provider failing with a transient
+// error, and holds them back to stay under its requests-per-minute limit.
+type retryingProvider struct {
+	name     string
+	provider ChatProvider
+	policy   RetryPolicy
+	limiter  *RateLimiter
+}
+
+// WithRetry wraps a provider with the retry policy set by retry.maxAttempts
+// and the rate limit set by requestsPerMinute in its config section. The rate
+// limit state is kept in stateDir so that it is shared by every gq process.
+func WithRetry(name string, section string, provider ChatProvider, stateDir string) ChatProvider {
+	policy := DefaultRetryPolicy
+	if maxAttempts := Config("retry").GetInt("maxAttempts"); maxAttempts > 0 {
+		policy.MaxAttempts = maxAttempts
+	}
+
+	var limiter *RateLimiter
+	if perMinute := Config(section).GetInt("requestsPerMinute"); perMinute > 0 && stateDir != "" {
+		limiter = &RateLimiter{Path: filepath.Join(stateDir, "ratelimit", name+".json"), PerMinute: perMinute}
+	}
+
+	retrying := retryingProvider{name: name, provider: provider, policy: policy, limiter: limiter}
+	if imageProvider, ok := provider.(ImageProvider); ok {
+		return retryingImageProvider{retryingProvider: retrying, imageProvider: imageProvider}
+	}
+	return retrying
+}
+
+func (p retryingProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	// A call that already streamed part of the answer can't be retried
+	// without printing that part twice.
+	streamed := false
+	if onChunk := req.Stream; onChunk != nil {
+		req.Stream = func(chunk string) error {
+			streamed = true
+			return onChunk(chunk)
+		}
+	}
+
+	var response ChatResponse
+	err := p.retry(ctx, req.Options.Verbose, func() bool { return streamed }, func(ctx context.Context) error {
+		var err error
+		response, err = p.provider.Chat(ctx, req)
+		return err
+	})
+	return response, err
+}
+
+// retryingImageProvider is the retrying wrapper of a provider that generates
+// images, so that only those are an ImageProvider once wrapped.
+type retryingImageProvider struct {
+	retryingProvider
+	imageProvider ImageProvider
+}
+
+func (p retryingImageProvider) GenerateImages(ctx context.Context, req ImageRequest) ([]GeneratedImage, error) {
+	var images []GeneratedImage
+	err := p.retry(ctx, req.Verbose, func() bool { return false }, func(ctx context.Context) error {
+		var err error
+		images, err = p.imageProvider.GenerateImages(ctx, req)
+		return err
+	})
+	return images, err
+}
+
+// retry makes the call until it succeeds, fails with an error that is not
+// worth retrying, or runs out of attempts. final reports whether the last
+// failed call can't be retried anyway.
+func (p retryingProvider) retry(ctx context.Context, verbose bool, final func() bool, call func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		if p.limiter != nil {
+			waited, err := p.limiter.Wait(ctx)
+			if err != nil {
+				return err
+			}
+			if waited > 0 && verbose {
+				fmt.Printf("\033[33mWaited %s to stay under %d requests per minute for %s\033[0m\n", waited.Round(time.Millisecond), p.limiter.PerMinute, p.name)
+			}
+		}
+
+		hint := &retryHint{}
+		err := call(context.WithValue(ctx, retryHintKey{}, hint))
+		if err == nil || final() || attempt >= p.policy.MaxAttempts || !retryable(ctx, err) {
+			return err
+		}
+
+		delay := retryAfter(err)
+		if delay == 0 {
+			delay = hint.retryAfter
+		}
+		if delay == 0 {
+			delay = p.policy.backoff(attempt)
+		}
+		if verbose {
+			fmt.Printf("\033[33mRetrying %s in %s (attempt %d of %d): %v\033[0m\n", p.name, delay.Round(time.Millisecond), attempt+1, p.policy.MaxAttempts, err)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// retryable reports whether err is worth retrying: rate limits, timeouts and
+// server errors are, while a host that can't be resolved or refuses
+// connections won't be fixed by trying again.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch KindOf(err) {
+	case ErrRateLimit, ErrTimeout:
+		return true
+	case ErrNetwork:
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) || strings.Contains(err.Error(), "no such host") {
+			return false
+		}
+		var opErr *net.OpError
+		return !errors.As(err, &opErr) || opErr.Op != "dial"
+	}
+	return false
+}
+
+// retryAfter returns the delay asked for by the service in the error, or zero.
+func retryAfter(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		return e.RetryAfter
+	}
+	var anthropicErr *AnthropicError
+	if errors.As(err, &anthropicErr) && anthropicErr.RetryAfter > 0 {
+		return anthropicErr.RetryAfter
+	}
+	var azureErr *azcore.ResponseError
+	if errors.As(err, &azureErr) && azureErr.RawResponse != nil {
+		return parseRetryAfter(azureErr.RawResponse.Header)
+	}
+	var awsErr *awshttp.ResponseError
+	if errors.As(err, &awsErr) && awsErr.Response != nil && awsErr.Response.Response != nil {
+		return parseRetryAfter(awsErr.Response.Header)
+	}
+	var googleErr *apierror.APIError
+	if errors.As(err, &googleErr) {
+		if info := googleErr.Details().RetryInfo; info != nil && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	return 0
+}
+
+// parseRetryAfter reads the Retry-After header, given either in seconds or as
+// an HTTP date, along with the retry-after-ms header sent by Azure OpenAI.
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// retryHint records the Retry-After header of the responses of a call, for
+// the SDKs whose errors don't expose the response headers.
+type retryHint struct {
+	retryAfter time.Duration
+}
+
+type retryHintKey struct{}
+
+// retryAfterTransport is an http.RoundTripper that records the Retry-After
+// header of the responses into the retryHint of the request context.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if hint, ok := req.Context().Value(retryHintKey{}).(*retryHint); ok && resp != nil {
+		hint.retryAfter = parseRetryAfter(resp.Header)
+	}
+	return resp, err
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RateLimiter holds requests back so that no more than PerMinute of them
+// start in any minute. The start times are kept in the file at Path, so the
+// limit holds across consecutive and concurrent gq processes.
+type RateLimiter struct {
+	Path      string
+	PerMinute int
+}
+
+// staleLock is the age after which a lock file left behind by a killed process is ignored.
+const staleLock = 10 * time.Second
+
+// Wait blocks until a request may start and records it. It returns how long it waited.
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	var waited time.Duration
+	for {
+		delay, err := l.reserve(ctx, time.Now())
+		if err != nil {
+			return waited, err
+		}
+		if delay <= 0 {
+			return waited, nil
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return waited, err
+		}
+		waited += delay
+	}
+}
+
+// reserve records a request at now when the limit allows it, otherwise it
+// returns how long to wait before trying again.
+func (l *RateLimiter) reserve(ctx context.Context, now time.Time) (time.Duration, error) {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return 0, err
+	}
+	unlock, err := l.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var starts []time.Time
+	if data, err := os.ReadFile(l.Path); err == nil {
+		// A corrupted file only loses the history of the last minute.
+		_ = json.Unmarshal(data, &starts)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	recent := starts[:0]
+	for _, start := range starts {
+		if now.Sub(start) < time.Minute {
+			recent = append(recent, start)
+		}
+	}
+	if len(recent) >= l.PerMinute {
+		return recent[len(recent)-l.PerMinute].Add(time.Minute).Sub(now), nil
+	}
+
+	data, err := json.Marshal(append(recent, now))
+	if err != nil {
+		return 0, err
+	}
+	return 0, os.WriteFile(l.Path, data, 0600)
+}
+
+// lock takes the lock file next to the state file and returns the function releasing it.
+func (l *RateLimiter) lock(ctx context.Context) (func(), error) {
+	path := l.Path + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		if err := sleep(ctx, 20*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+}
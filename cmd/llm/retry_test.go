@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type chatFunc func(ctx context.Context, req ChatRequest) (ChatResponse, error)
+
+func (f chatFunc) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return f(ctx, req)
+}
+
+var testPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestRetryingProviderRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	provider := retryingProvider{name: "test", policy: testPolicy, provider: chatFunc(func(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+		calls++
+		if calls < 3 {
+			return ChatResponse{}, &Error{Kind: ErrRateLimit, RetryAfter: time.Millisecond}
+		}
+		return ChatResponse{Text: "Olympia"}, nil
+	})}
+
+	response, err := provider.Chat(context.Background(), NewChatRequest("capital of Washington?", Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Text != "Olympia" || calls != 3 {
+		t.Errorf("got %q after %d calls, want Olympia after 3", response.Text, calls)
+	}
+}
+
+func TestWithRetryKeepsImageGeneration(t *testing.T) {
+	if _, ok := WithRetry("ollama", "ollama", OllamaProvider{}, "").(ImageProvider); ok {
+		t.Error("ollama doesn't generate images")
+	}
+	if _, ok := WithRetry("openAI", "openAI", OpenAIProvider{}, "").(ImageProvider); !ok {
+		t.Error("openAI generates images")
+	}
+}
+
+func TestRetryingProviderGivesUp(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err       error
+		stream    bool
+		wantCalls int
+	}{
+		"max attempts":     {err: &Error{Kind: ErrNetwork}, wantCalls: 3},
+		"not transient":    {err: &Error{Kind: ErrAuth}, wantCalls: 1},
+		"quota":            {err: &Error{Kind: ErrQuota}, wantCalls: 1},
+		"already streamed": {err: &Error{Kind: ErrRateLimit}, stream: true, wantCalls: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			provider := retryingProvider{name: "test", policy: testPolicy, provider: chatFunc(func(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+				calls++
+				if req.Stream != nil {
+					req.Stream("Oly")
+				}
+				return ChatResponse{}, tc.err
+			})}
+
+			req := NewChatRequest("capital of Washington?", Options{})
+			if tc.stream {
+				req.Stream = func(string) error { return nil }
+			}
+			_, err := provider.Chat(context.Background(), req)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":     0,
+		"2":    2 * time.Second,
+		"0.5":  500 * time.Millisecond,
+		"soon": 0,
+	} {
+		header := http.Header{}
+		header.Set("Retry-After", value)
+		if got := parseRetryAfter(header); got != want {
+			t.Errorf("Retry-After %q: got %s, want %s", value, got, want)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("retry-after-ms", "250")
+	header.Set("Retry-After", "1")
+	if got := parseRetryAfter(header); got != 250*time.Millisecond {
+		t.Errorf("retry-after-ms: got %s, want 250ms", got)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &RateLimiter{Path: t.TempDir() + "/test.json", PerMinute: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		delay, err := limiter.reserve(context.Background(), now.Add(time.Duration(i)*time.Second))
+		if err != nil || delay != 0 {
+			t.Fatalf("request %d: got delay %s and error %v, want none", i, delay, err)
+		}
+	}
+
+	delay, err := limiter.reserve(context.Background(), now.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delay != 50*time.Second {
+		t.Errorf("got delay %s, want 50s until the first request leaves the window", delay)
+	}
+
+	if delay, _ := limiter.reserve(context.Background(), now.Add(time.Minute)); delay != 0 {
+		t.Errorf("got delay %s once the first request left the window, want none", delay)
+	}
+}
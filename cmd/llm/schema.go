@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Schema asks for an answer in JSON matching a JSON Schema. Callers put its
+// Instruction in the system prompt, and providers with a structured output
+// feature also pass the schema along. The answer is validated anyway.
+type Schema struct {
+	// Name identifies the schema for the providers that need one, e.g. OpenAI.
+	Name string
+	// Definition is the JSON Schema document.
+	Definition json.RawMessage
+
+	compiled *jsonschema.Schema
+}
+
+// NewSchema compiles the JSON Schema document, so that invalid schemas are
+// reported before any call is made.
+func NewSchema(name string, definition []byte) (*Schema, error) {
+	var decoded map[string]any
+	if err := json.Unmarshal(definition, &decoded); err != nil {
+		return nil, fmt.Errorf("the schema is not a JSON object: %w", err)
+	}
+	compiled, err := jsonschema.CompileString(name+".json", string(definition))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	return &Schema{Name: name, Definition: definition, compiled: compiled}, nil
+}
+
+// Instruction tells the model to answer with JSON matching the schema.
+func (s *Schema) Instruction() string {
+	return "Answer only with JSON matching this JSON Schema, without any other text or code fences:\n" + string(s.Definition)
+}
+
+// Validate parses the answer and checks it against the schema. Code fences
+// around the JSON are ignored. The error lists every violation found.
+func (s *Schema) Validate(answer string) (any, error) {
+	decoder := json.NewDecoder(strings.NewReader(unfence(answer)))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("the answer is not valid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, errors.New("the answer holds more than one JSON value")
+	}
+
+	if err := s.compiled.Validate(value); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, fmt.Errorf("the answer doesn't match the schema: %s", strings.Join(violations(validationErr), "; "))
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// violations returns the leaf errors of a validation error, the ones naming
+// what is actually wrong, with the location of the value at fault.
+func violations(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{location + ": " + err.Message}
+	}
+	var out []string
+	for _, cause := range err.Causes {
+		out = append(out, violations(cause)...)
+	}
+	return out
+}
+
+// unfence returns the content of the code fence wrapping the text, if any.
+func unfence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	_, body, found := strings.Cut(text, "\n")
+	if !found {
+		return text
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(body), "```"))
+}
+
+// decoded returns the schema as a map, for the SDKs taking it as a structure.
+func (s *Schema) decoded() map[string]any {
+	var decoded map[string]any
+	json.Unmarshal(s.Definition, &decoded)
+	return decoded
+}
+
+// object reports whether the schema describes a JSON object, the only kind of
+// value the tools of the tool use trick take.
+func (s *Schema) object() bool {
+	return s.decoded()["type"] == "object"
+}
+
+// geminiSchema converts a JSON Schema to the OpenAPI subset Gemini accepts.
+// Keywords Gemini doesn't know are dropped, the answer is validated locally
+// against the full schema anyway.
+func geminiSchema(definition map[string]any) *genai.Schema {
+	schema := &genai.Schema{}
+	switch t := definition["type"].(type) {
+	case string:
+		schema.Type = geminiType(t)
+	case []any:
+		// e.g. ["string", "null"]
+		for _, v := range t {
+			if name, _ := v.(string); name == "null" {
+				schema.Nullable = true
+			} else if schema.Type == genai.TypeUnspecified {
+				schema.Type = geminiType(name)
+			}
+		}
+	}
+	schema.Description, _ = definition["description"].(string)
+	schema.Format, _ = definition["format"].(string)
+	if values, ok := definition["enum"].([]any); ok {
+		for _, v := range values {
+			if v == nil {
+				schema.Nullable = true
+			} else {
+				schema.Enum = append(schema.Enum, fmt.Sprint(v))
+			}
+		}
+	}
+	if items, ok := definition["items"].(map[string]any); ok {
+		schema.Items = geminiSchema(items)
+	}
+	if properties, ok := definition["properties"].(map[string]any); ok {
+		schema.Properties = map[string]*genai.Schema{}
+		for name, property := range properties {
+			if property, ok := property.(map[string]any); ok {
+				schema.Properties[name] = geminiSchema(property)
+			}
+		}
+	}
+	if required, ok := definition["required"].([]any); ok {
+		for _, name := range required {
+			schema.Required = append(schema.Required, fmt.Sprint(name))
+		}
+	}
+	return schema
+}
+
+func geminiType(name string) genai.Type {
+	switch name {
+	case "object":
+		return genai.TypeObject
+	case "array":
+		return genai.TypeArray
+	case "string":
+		return genai.TypeString
+	case "integer":
+		return genai.TypeInteger
+	case "number":
+		return genai.TypeNumber
+	case "boolean":
+		return genai.TypeBoolean
+	}
+	return genai.TypeUnspecified
+}
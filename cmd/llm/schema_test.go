@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const repoSchema = `{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string"},
+    "stars": {"type": "integer", "minimum": 0},
+    "topics": {"type": "array", "items": {"type": "string"}},
+    "license": {"type": ["string", "null"], "enum": ["MIT", "Apache-2.0", null]}
+  },
+  "required": ["name", "stars"]
+}`
+
+func TestNewSchema(t *testing.T) {
+	if _, err := NewSchema("repo", []byte(repoSchema)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSchema("bad", []byte(`{"type": 5}`)); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+	if _, err := NewSchema("bad", []byte(`not json`)); err == nil {
+		t.Error("expected an error for a schema that isn't JSON")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := NewSchema("repo", []byte(repoSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := schema.Validate("```json\n{\"name\": \"gq\", \"stars\": 5}\n```")
+	if err != nil {
+		t.Fatalf("a fenced valid answer was rejected: %v", err)
+	}
+	if value.(map[string]any)["name"] != "gq" {
+		t.Errorf("unexpected value %v", value)
+	}
+
+	_, err = schema.Validate(`{"stars": -1, "topics": ["cli", 3]}`)
+	if err == nil {
+		t.Fatal("expected an error for an invalid answer")
+	}
+	for _, want := range []string{"/stars", "/topics/1", "name"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q doesn't mention %s", err, want)
+		}
+	}
+
+	if _, err := schema.Validate("Sure! Here it is"); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("got %v, want an error saying the answer isn't JSON", err)
+	}
+	if _, err := schema.Validate(`{"name": "a", "stars": 1} {"name": "b", "stars": 2}`); err == nil {
+		t.Error("expected an error for several JSON values")
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	schema, err := NewSchema("repo", []byte(repoSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted := geminiSchema(schema.decoded())
+	if converted.Type != genai.TypeObject || len(converted.Required) != 2 {
+		t.Errorf("unexpected schema %+v", converted)
+	}
+	if converted.Properties["stars"].Type != genai.TypeInteger {
+		t.Errorf("stars: got %v", converted.Properties["stars"].Type)
+	}
+	if topics := converted.Properties["topics"]; topics.Type != genai.TypeArray || topics.Items.Type != genai.TypeString {
+		t.Errorf("topics: got %+v", topics)
+	}
+	if license := converted.Properties["license"]; license.Type != genai.TypeString || !license.Nullable || len(license.Enum) != 2 {
+		t.Errorf("license: got %+v", license)
+	}
+	if !schema.object() {
+		t.Error("the schema describes an object")
+	}
+}
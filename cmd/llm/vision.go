@@ -0,0 +1,66 @@
+package llm
+
+import "strings"
+
+// textOnlyModels are prefixes of the model names known not to accept images.
+// Models missing from the list are assumed to see them and left to reject
+// the images themselves, as are the "-vision" variants of the listed ones.
+var textOnlyModels = []string{
+	// OpenAI
+	"gpt-3.5", "gpt-4-0", "gpt-4-32k", "o1-mini", "o3-mini",
+	// Gemini
+	"gemini-pro", "gemini-1.0-pro",
+	// Anthropic
+	"claude-2", "claude-instant", "claude-3-5-haiku",
+	// Bedrock
+	"anthropic.claude-v2", "anthropic.claude-instant", "anthropic.claude-3-5-haiku",
+	"meta.llama2", "meta.llama3-8b", "meta.llama3-70b", "meta.llama3-1", "meta.llama3-2-1b", "meta.llama3-2-3b", "meta.llama3-3",
+	"mistral.", "cohere.", "ai21.", "amazon.titan-text", "amazon.titan-image", "amazon.nova-micro",
+}
+
+// supportsImages reports whether the model accepts images, going by its name.
+// Bedrock cross-region inference profiles are matched without their region prefix.
+func supportsImages(model string) bool {
+	name := strings.ToLower(model)
+	if name == "gpt-4" {
+		return false
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, region := range []string{"us.", "eu.", "apac.", "us-gov."} {
+		name = strings.TrimPrefix(name, region)
+	}
+	if strings.Contains(name, "-vision") {
+		return true
+	}
+	for _, prefix := range textOnlyModels {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// requireVision returns an error when the request carries images and the
+// model can't see them. Setting vision in the config section of the provider
+// overrides the guess made from the model name, e.g. for fine-tuned models or
+// Azure deployments.
+func requireVision(provider string, section string, model string, req ChatRequest) error {
+	if !req.HasImages() {
+		return nil
+	}
+	config := Config(section)
+	if config.IsSet("vision") {
+		if config.GetBool("vision") {
+			return nil
+		}
+	} else if supportsImages(model) {
+		return nil
+	}
+	return &Error{
+		Kind:     ErrBadConfig,
+		Provider: provider,
+		Message:  "model " + model + " does not support images. Select a vision model with -m, or set " + section + ".vision: true if it does",
+	}
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSupportsImages(t *testing.T) {
+	for model, want := range map[string]bool{
+		"gpt-4o-mini":                            true,
+		"gpt-4":                                  false,
+		"gpt-3.5-turbo":                          false,
+		"o3-mini":                                false,
+		"gemini-1.5-flash":                       true,
+		"gemini-1.0-pro":                         false,
+		"gemini-pro":                             false,
+		"gemini-pro-vision":                      true,
+		"gemini-1.0-pro-vision-latest":           true,
+		"claude-3-5-sonnet-20240620":             true,
+		"claude-2.1":                             false,
+		"anthropic.claude-3-haiku-20240307-v1:0": true,
+		"arn:aws:bedrock:us-east-1:123:inference-profile/us.meta.llama3-2-90b-instruct-v1:0": true,
+		"us.meta.llama3-1-70b-instruct-v1:0":                                                 false,
+		"mistral.mistral-large-2402-v1:0":                                                    false,
+		"llava":                                                                              true,
+	} {
+		if got := supportsImages(model); got != want {
+			t.Errorf("%s: got %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestRequireVision(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	text := NewChatRequest("Hi", Options{})
+	if err := requireVision("openAI", "openAI", "gpt-3.5-turbo", text); err != nil {
+		t.Errorf("a request without images was rejected: %v", err)
+	}
+
+	withImage := ChatRequest{Messages: []Message{{Role: RoleUser, Content: "What's wrong?", Images: []Image{{MIMEType: "image/png", Data: []byte("png")}}}}}
+	err := requireVision("openAI", "openAI", "gpt-3.5-turbo", withImage)
+	if KindOf(err) != ErrBadConfig || !strings.Contains(err.Error(), "does not support images") {
+		t.Errorf("got %v, want an error saying the model can't see images", err)
+	}
+
+	viper.Set("openAI.vision", true)
+	if err := requireVision("openAI", "openAI", "gpt-3.5-turbo", withImage); err != nil {
+		t.Errorf("vision: true was ignored: %v", err)
+	}
+	viper.Set("openAI.vision", false)
+	if err := requireVision("openAI", "openAI", "gpt-4o", withImage); err == nil {
+		t.Error("vision: false was ignored")
+	}
+}
+
+func TestClaudeImageBlocks(t *testing.T) {
+	req := ChatRequest{Messages: []Message{{Role: RoleUser, Content: "What's wrong?", Images: []Image{{MIMEType: "image/png", Data: []byte("png")}}}}}
+	body, err := json.Marshal(claudeMessages(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"cG5n"}},{"type":"text","text":"What's wrong?"}]}]`
+	if string(body) != want {
+		t.Errorf("got %s, want %s", body, want)
+	}
+}
@@ -0,0 +1,144 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a fenced code block of an answer.
+type CodeBlock struct {
+	// Lang is the language of the info string, e.g. bash, empty when not given.
+	Lang string
+	// FileName is the file the answer names for the block, empty when it doesn't.
+	FileName string
+	Code     string
+}
+
+var (
+	openingFence = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	// fileName matches a relative path ending with an extension, e.g. src/app.py.
+	fileName = regexp.MustCompile(`^[\w.-]+(/[\w.-]+)*\.\w+$`)
+	// fileAttribute matches the file name attributes of info strings, e.g. title="app.py".
+	fileAttribute = regexp.MustCompile(`^(?:title|file|filename|name|path)=["']?([^"']+)["']?$`)
+	// fileComment matches a first line naming the file, e.g. // main.go or # file: app.py.
+	fileComment = regexp.MustCompile(`^(?://|#|--|;|/\*|<!--)\s*(?:(?i:file(?:name)?|path):\s*)?(\S+?)\s*(?:\*/|-->)?$`)
+	// fileLabel matches a line introducing a block with its file name, e.g. **app.py**: or File: `app.py`.
+	fileLabel = regexp.MustCompile("^(?:#+\\s*)?(?:(?i:file(?:name)?|path):\\s*)?[*_`]*([^*_`\\s]+)[*_`]*:?$")
+)
+
+// CodeBlocks returns the fenced code blocks of the text, in order. A block
+// left open, e.g. by an answer cut short, runs to the end of the text.
+func CodeBlocks(text string) []CodeBlock {
+	var blocks []CodeBlock
+	lines := strings.Split(text, "\n")
+	previous := ""
+	for i := 0; i < len(lines); i++ {
+		opening := openingFence.FindStringSubmatch(lines[i])
+		if opening == nil {
+			if strings.TrimSpace(lines[i]) != "" {
+				previous = strings.TrimSpace(lines[i])
+			}
+			continue
+		}
+		indent, fence, info := len(opening[1]), opening[2], strings.Fields(opening[3])
+
+		var code []string
+		for i++; i < len(lines); i++ {
+			if closing(lines[i], fence) {
+				break
+			}
+			code = append(code, unindent(lines[i], indent))
+		}
+
+		block := CodeBlock{Code: strings.Join(code, "\n")}
+		if len(info) > 0 {
+			block.Lang, block.FileName, _ = strings.Cut(info[0], ":")
+			for _, attribute := range info[1:] {
+				if block.FileName != "" {
+					break
+				}
+				if match := fileAttribute.FindStringSubmatch(attribute); match != nil {
+					block.FileName = match[1]
+				} else if fileName.MatchString(attribute) {
+					block.FileName = attribute
+				}
+			}
+		}
+		if block.FileName == "" && len(code) > 0 {
+			if match := fileComment.FindStringSubmatch(strings.TrimSpace(code[0])); match != nil && fileName.MatchString(match[1]) {
+				block.FileName = match[1]
+			}
+		}
+		if block.FileName == "" {
+			if match := fileLabel.FindStringSubmatch(previous); match != nil && fileName.MatchString(match[1]) {
+				block.FileName = match[1]
+			}
+		}
+		blocks = append(blocks, block)
+		previous = ""
+	}
+	return blocks
+}
+
+// closing reports whether the line closes a block opened with fence: the same
+// character, at least as many times, and nothing else.
+func closing(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 || len(trimmed) < len(fence) {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// unindent removes up to indent leading spaces, the indentation of the fence.
+func unindent(line string, indent int) string {
+	for i := 0; i < indent && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// extensions maps the languages of info strings to file extensions, when
+// they differ from the language itself.
+var extensions = map[string]string{
+	"bash":       "sh",
+	"shell":      "sh",
+	"console":    "sh",
+	"python":     "py",
+	"python3":    "py",
+	"golang":     "go",
+	"javascript": "js",
+	"node":       "js",
+	"typescript": "ts",
+	"rust":       "rs",
+	"ruby":       "rb",
+	"kotlin":     "kt",
+	"c++":        "cpp",
+	"csharp":     "cs",
+	"c#":         "cs",
+	"yml":        "yaml",
+	"markdown":   "md",
+	"text":       "txt",
+	"plaintext":  "txt",
+	"powershell": "ps1",
+	"perl":       "pl",
+	"haskell":    "hs",
+	"elixir":     "ex",
+	"terraform":  "tf",
+	"hcl":        "tf",
+}
+
+var plainExtension = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Extension returns the file extension of the language, e.g. sh for bash,
+// and txt when the language is unknown or not given.
+func Extension(lang string) string {
+	lang = strings.ToLower(lang)
+	if extension, ok := extensions[lang]; ok {
+		return extension
+	}
+	if plainExtension.MatchString(lang) {
+		return lang
+	}
+	return "txt"
+}
@@ -0,0 +1,38 @@
+package markdown
+
+import "testing"
+
+const script = "Here is the script:\n\n```bash\n#!/bin/bash\necho start\n```\n\n**app.py**:\n\n```python\nprint('hi')\n\nprint('bye')\n```\n\n````markdown\n```go\nnested\n```\n````\n\n```go title=\"cmd/main.go\"\npackage main\n```\n\n```\n// util.js\nexport {}\n```\n\n  ```sql:schema.sql\n  SELECT 1;\n  ```\n\n```yaml\nkey: cut short"
+
+func TestCodeBlocks(t *testing.T) {
+	want := []CodeBlock{
+		{Lang: "bash", Code: "#!/bin/bash\necho start"},
+		{Lang: "python", FileName: "app.py", Code: "print('hi')\n\nprint('bye')"},
+		{Lang: "markdown", Code: "```go\nnested\n```"},
+		{Lang: "go", FileName: "cmd/main.go", Code: "package main"},
+		{FileName: "util.js", Code: "// util.js\nexport {}"},
+		{Lang: "sql", FileName: "schema.sql", Code: "SELECT 1;"},
+		{Lang: "yaml", Code: "key: cut short"},
+	}
+	got := CodeBlocks(script)
+	if len(got) != len(want) {
+		t.Fatalf("got %d blocks: %+v", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("block %d: got %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+
+	if blocks := CodeBlocks("No code here, only `inline` code."); len(blocks) != 0 {
+		t.Errorf("got %+v, want no block", blocks)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for lang, want := range map[string]string{"bash": "sh", "Python": "py", "go": "go", "lua": "lua", "": "txt", "objective-c": "txt"} {
+		if got := Extension(lang); got != want {
+			t.Errorf("%q: got %q, want %q", lang, got, want)
+		}
+	}
+}
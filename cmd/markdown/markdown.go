@@ -0,0 +1,200 @@
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/muesli/termenv"
+)
+
+// DefaultWidth is the width answers are wrapped at when the terminal's is unknown.
+const DefaultWidth = 80
+
+// Options configures a Renderer.
+type Options struct {
+	// Theme is a glamour style name, e.g. dark, light or dracula, or the path
+	// of a JSON style file. auto picks dark or light from the terminal background.
+	Theme string
+	// Width is the column answers are wrapped at, DefaultWidth when 0.
+	Width int
+	// NoColor renders the answer without colors, e.g. when NO_COLOR is set.
+	NoColor bool
+}
+
+// Renderer renders markdown for the terminal: headings, lists, tables and
+// syntax-highlighted code blocks.
+type Renderer struct {
+	term *glamour.TermRenderer
+}
+
+// New returns a renderer. An unknown theme is an error.
+func New(options Options) (*Renderer, error) {
+	if options.Theme == "" {
+		options.Theme = "auto"
+	}
+	if options.Width <= 0 {
+		options.Width = DefaultWidth
+	}
+	profile := termenv.TrueColor
+	if options.NoColor {
+		profile = termenv.Ascii
+	}
+
+	term, err := glamour.NewTermRenderer(
+		glamour.WithStylePath(options.Theme),
+		glamour.WithWordWrap(options.Width),
+		glamour.WithColorProfile(profile),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unknown theme %q. Use dark, light, dracula, tokyo-night, pink, ascii, notty, auto or the path of a style file", options.Theme)
+	}
+	return &Renderer{term: term}, nil
+}
+
+// Render returns the markdown text rendered for the terminal, without the
+// blank lines glamour surrounds it with.
+func (r *Renderer) Render(text string) (string, error) {
+	out, err := r.term.Render(text)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(out, "\n")
+	for len(lines) > 1 && blank(lines[0]) {
+		// The escape sequences of a blank line, e.g. a reset, still apply.
+		lines[1] = escapes(lines[0]) + lines[1]
+		lines = lines[1:]
+	}
+	for len(lines) > 1 && blank(lines[len(lines)-1]) {
+		lines[len(lines)-2] += escapes(lines[len(lines)-1])
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 1 && blank(lines[0]) {
+		return escapes(lines[0]), nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+var escape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// blank reports whether the line shows nothing but spaces.
+func blank(line string) bool {
+	return strings.TrimSpace(escape.ReplaceAllString(line, "")) == ""
+}
+
+// escapes returns the escape sequences of the line, without its text.
+func escapes(line string) string {
+	return strings.Join(escape.FindAllString(line, -1), "")
+}
+
+// Stream renders markdown written to it chunk by chunk, as an answer is
+// streamed. A block can only be rendered once complete, so Stream holds the
+// text back until the block after it starts, and Close renders what is left.
+type Stream struct {
+	renderer *Renderer
+	w        io.Writer
+	pending  string
+	started  bool
+}
+
+// NewStream returns a stream rendering to w.
+func (r *Renderer) NewStream(w io.Writer) *Stream {
+	return &Stream{renderer: r, w: w}
+}
+
+// Write buffers the chunk, and renders the blocks it completes.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.pending += string(p)
+	complete, rest := splitBlocks(s.pending)
+	if complete == "" {
+		return len(p), nil
+	}
+	s.pending = rest
+	if err := s.render(complete); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close renders the rest of the text. It doesn't close the underlying writer.
+func (s *Stream) Close() error {
+	if strings.TrimSpace(s.pending) == "" {
+		return nil
+	}
+	text := s.pending
+	s.pending = ""
+	return s.render(text)
+}
+
+func (s *Stream) render(text string) error {
+	out, err := s.renderer.Render(text)
+	if err != nil {
+		return err
+	}
+	if s.started {
+		out = "\n\n" + out
+	}
+	s.started = true
+	_, err = io.WriteString(s.w, out)
+	return err
+}
+
+var (
+	fence = regexp.MustCompile("^ {0,3}(```|~~~)")
+	// continuation matches the lines that may carry on the block before a
+	// blank line: list items of a loose list and indented content.
+	continuation = regexp.MustCompile(`^([ \t]|[-*+][ \t]|\d{1,9}[.)][ \t])`)
+)
+
+// splitBlocks splits the text at its last block boundary: a blank line
+// outside a code block, followed by a complete line starting a new block.
+// complete is empty when the text holds no boundary yet.
+func splitBlocks(text string) (complete string, rest string) {
+	var (
+		inFence    string
+		offset     int
+		blank      = -1
+		inBlank    bool
+		splitStart = -1
+		splitEnd   int
+	)
+	for {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			break
+		}
+		line := text[offset : offset+end]
+		next := offset + end + 1
+
+		if marker := fence.FindStringSubmatch(line); marker != nil {
+			if inFence == "" {
+				if inBlank {
+					splitStart, splitEnd = blank, offset
+				}
+				inFence = marker[1]
+			} else if marker[1] == inFence {
+				inFence = ""
+			}
+			inBlank = false
+		} else if inFence != "" {
+			// Code blocks are never split.
+		} else if strings.TrimSpace(line) == "" {
+			if !inBlank {
+				blank = offset
+			}
+			inBlank = true
+		} else {
+			if inBlank && !continuation.MatchString(line) {
+				splitStart, splitEnd = blank, offset
+			}
+			inBlank = false
+		}
+		offset = next
+	}
+	if splitStart <= 0 {
+		return "", text
+	}
+	return text[:splitStart], text[splitEnd:]
+}
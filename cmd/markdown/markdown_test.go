@@ -0,0 +1,98 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+const answer = "# Backup\n\nRun the *script*:\n\n```bash\necho start\n\necho done\n```\n\n1. first\n\n2. second\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\nDone."
+
+func TestSplitBlocks(t *testing.T) {
+	for _, c := range []struct {
+		text     string
+		complete string
+	}{
+		{"Hello", ""},
+		{"Hello\n\n", ""},
+		// The next block may still be a line of the first one until it is complete.
+		{"Hello\n\nWor", ""},
+		{"Hello\n\nWorld\n", "Hello\n"},
+		{"Hello\n\nWorld\n\nAgain\n", "Hello\n\nWorld\n"},
+		// Blank lines in code blocks don't end them.
+		{"```\na\n\nb\n", ""},
+		{"```\na\n\nb\n```\n\nText\n", "```\na\n\nb\n```\n"},
+		{"Text\n\n```go\n", "Text\n"},
+		// Loose lists and indented content carry on the block.
+		{"- a\n\n- b\n", ""},
+		{"1. a\n\n   more\n", ""},
+		{"- a\n\nText\n", "- a\n"},
+	} {
+		complete, rest := splitBlocks(c.text)
+		if complete != c.complete {
+			t.Errorf("%q: got %q, want %q", c.text, complete, c.complete)
+		}
+		if complete != "" && !strings.HasSuffix(c.text, rest) {
+			t.Errorf("%q: the rest %q is not the end of the text", c.text, rest)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	r, err := New(Options{Theme: "dark", NoColor: true, Width: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.Render(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Backup", "echo done", "1. first", "2. second", "│"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is missing from %q", want, out)
+		}
+	}
+	for _, unwanted := range []string{"```", "*script*", "\033[3"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("%q is left in %q", unwanted, out)
+		}
+	}
+
+	if _, err := New(Options{Theme: "no-such-theme"}); err == nil {
+		t.Error("expected an error for an unknown theme")
+	}
+}
+
+func TestStream(t *testing.T) {
+	r, err := New(Options{Theme: "dark", NoColor: true, Width: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err := r.Render(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	stream := r.NewStream(&out)
+	for _, chunk := range strings.SplitAfter(answer, " ") {
+		if _, err := stream.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks rendered one by one only differ in the padding of the lines between them.
+	if got, want := lines(out.String()), lines(whole); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("streamed:\n%s\nwhole:\n%s", out.String(), whole)
+	}
+}
+
+func lines(text string) []string {
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		out = append(out, strings.TrimRight(line, " "))
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/markdown"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// personaSettings lists the settings of the personas defined under personas.<name>.
+// Every one of them is optional, a persona only overrides what it sets.
+var personaSettings = []setting{
+	{key: "system"},
+	{key: "provider"},
+	{key: "model"},
+	temperatureSetting,
+}
+
+// callSettings is what a call needs on top of the conversation: the provider,
+// the generation options and the system prompt.
+type callSettings struct {
+	provider string
+	options  llm.Options
+	system   string
+	// usage is the format of the usage summary, text or json, empty when --usage is not set.
+	usage string
+	// jsonOutput wraps the answer in a JSON envelope, see --json.
+	jsonOutput bool
+	// schema is the JSON Schema the answer must match, see --schema.
+	schema        *llm.Schema
+	schemaRetries int
+	// code selects the code blocks printed instead of the answer, nil to print the answer, see --code.
+	code *codeSelection
+	// renderer renders the markdown of the answers, nil when they are printed raw, see --render.
+	renderer *markdown.Renderer
+}
+
+/**
+* This function returns the names of the personas defined in the config in a stable order
+ */
+func personaNames() []string {
+	return sortedKeys(viper.GetStringMap("personas"))
+}
+
+/**
+* This function resolves the settings of a call. Flags win over the persona
+* selected with --persona, which wins over the config file. The provider is
+* left empty when neither the flags nor the persona select one.
+ */
+func settingsFromFlags(cmd *cobra.Command) (callSettings, error) {
+	flags := cmd.Flags()
+	settings := callSettings{options: optionsFromFlags(cmd)}
+	settings.provider, _ = flags.GetString("provider")
+
+	if name, _ := flags.GetString("persona"); name != "" {
+		if err := settings.applyPersona(name); err != nil {
+			return callSettings{}, err
+		}
+	}
+
+	if settings.usage, _ = flags.GetString("usage"); settings.usage != "" && settings.usage != "text" && settings.usage != "json" {
+		return callSettings{}, newUsageError("unknown usage format %q. Use --usage or --usage=json", settings.usage)
+	}
+
+	settings.jsonOutput, _ = flags.GetBool("json")
+	settings.schemaRetries, _ = flags.GetInt("schema-retries")
+	if path, _ := flags.GetString("schema"); path != "" {
+		schema, err := loadSchema(path)
+		if err != nil {
+			return callSettings{}, err
+		}
+		settings.schema = schema
+	}
+	code, err := codeFromFlags(cmd)
+	if err != nil {
+		return callSettings{}, err
+	}
+	if code != nil && (settings.jsonOutput || settings.schema != nil) {
+		return callSettings{}, newUsageError("--code can't be used with --json or --schema")
+	}
+	settings.code = code
+
+	if !settings.jsonOutput && settings.schema == nil && settings.code == nil {
+		renderer, err := answerRenderer(cmd)
+		if err != nil {
+			return callSettings{}, err
+		}
+		settings.renderer = renderer
+	}
+
+	system, _ := flags.GetString("system")
+	systemFile, _ := flags.GetString("system-file")
+	if system != "" && systemFile != "" {
+		return callSettings{}, newUsageError("--system and --system-file can't be used together")
+	}
+	if system != "" {
+		settings.system = system
+	}
+	if systemFile != "" {
+		data, err := os.ReadFile(systemFile)
+		if err != nil {
+			return callSettings{}, newUsageError("reading the system prompt: %s", err)
+		}
+		settings.system = strings.TrimSpace(string(data))
+	}
+	return settings, nil
+}
+
+/**
+* This function fills the settings that were not given as flags from the persona
+ */
+func (settings *callSettings) applyPersona(name string) error {
+	key := "personas." + name
+	if !viper.IsSet(key) {
+		names := personaNames()
+		if len(names) == 0 {
+			return llm.ConfigError("", "unknown persona %q. Define it under personas in the config file", name)
+		}
+		return llm.ConfigError("", "unknown persona %q. Use one of %s", name, strings.Join(names, ", "))
+	}
+
+	settings.system = viper.GetString(key + ".system")
+	personaProvider := viper.GetString(key + ".provider")
+	if settings.provider == "" {
+		settings.provider = personaProvider
+	}
+
+	// The model and temperature of the persona are meant for its provider,
+	// another provider picked with -p keeps its own.
+	if personaProvider != "" && !strings.EqualFold(personaProvider, settings.provider) {
+		if settings.options.Verbose {
+			fmt.Printf("\033[33mIgnoring the model and temperature of persona %s, set for %s\033[0m\n", name, personaProvider)
+		}
+	} else {
+		if settings.options.Model == "" {
+			settings.options.Model = viper.GetString(key + ".model")
+		}
+		if settings.options.Temperature == nil && viper.IsSet(key+".temperature") {
+			temperature := viper.GetFloat64(key + ".temperature")
+			settings.options.Temperature = &temperature
+		}
+	}
+
+	if settings.options.Verbose {
+		fmt.Println("\033[33mUsing persona: \033[0m")
+		fmt.Println("\033[36m" + name + "\033[0m")
+	}
+	return nil
+}
+
+/**
+* This function puts the system prompt, when there is one, ahead of the
+* conversation. Each provider sends it the way its API expects.
+ */
+func withSystemPrompt(system string, messages []llm.Message) []llm.Message {
+	if system == "" {
+		return messages
+	}
+	return append([]llm.Message{{Role: llm.RoleSystem, Content: system}}, messages...)
+}
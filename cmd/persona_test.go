@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestApplyPersona(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("personas.reviewer", map[string]any{
+		"system":      "Be strict.",
+		"provider":    "openAI",
+		"model":       "gpt-4o",
+		"temperature": 0.1,
+	})
+	viper.Set("personas.terse.system", "Be terse.")
+	viper.Set("personas.terse.model", "llama3")
+
+	settings := callSettings{}
+	if err := settings.applyPersona("reviewer"); err != nil {
+		t.Fatal(err)
+	}
+	if settings.provider != "openAI" || settings.options.Model != "gpt-4o" || settings.options.Temperature == nil || settings.system != "Be strict." {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+
+	// -p picking another provider keeps its own model and temperature.
+	settings = callSettings{provider: "ollama"}
+	if err := settings.applyPersona("reviewer"); err != nil {
+		t.Fatal(err)
+	}
+	if settings.provider != "ollama" || settings.options.Model != "" || settings.options.Temperature != nil || settings.system != "Be strict." {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+
+	// A persona without a provider applies its model to any provider.
+	settings = callSettings{provider: "ollama"}
+	if err := settings.applyPersona("terse"); err != nil {
+		t.Fatal(err)
+	}
+	if settings.options.Model != "llama3" {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+
+	if err := settings.applyPersona("unknown"); err == nil {
+		t.Error("expected an error for an unknown persona")
+	}
+}
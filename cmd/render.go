@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/markdown"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+/**
+* This function returns the renderer of the answers, or nil when they are
+* printed as raw text: with --raw, when render.enabled is false, or when
+* stdout is not a terminal unless --render is set.
+ */
+func answerRenderer(cmd *cobra.Command) (*markdown.Renderer, error) {
+	raw, _ := cmd.Flags().GetBool("raw")
+	render, _ := cmd.Flags().GetBool("render")
+	if raw && render {
+		return nil, newUsageError("--raw and --render can't be used together")
+	}
+
+	terminal := term.IsTerminal(int(os.Stdout.Fd()))
+	switch {
+	case raw:
+		return nil, nil
+	case render:
+	case viper.IsSet("render.enabled") && !viper.GetBool("render.enabled"):
+		return nil, nil
+	case !terminal:
+		return nil, nil
+	}
+
+	options := markdown.Options{
+		Theme:   viper.GetString("render.theme"),
+		Width:   viper.GetInt("render.width"),
+		NoColor: os.Getenv("NO_COLOR") != "",
+	}
+	if options.Width == 0 && terminal {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			options.Width = width
+		}
+	}
+	if (options.Theme == "" || options.Theme == "auto") && !terminal {
+		// auto can't ask a pipe for its background color.
+		options.Theme = "dark"
+	}
+
+	renderer, err := markdown.New(options)
+	if err != nil {
+		return nil, llm.ConfigError("", "render.theme: %s", err)
+	}
+	return renderer, nil
+}
+
+/**
+* This function returns the writer the answer is streamed to, rendering it
+* when renderer is set. The returned function renders what is left and
+* must be called once the answer is complete.
+ */
+func answerWriter(w io.Writer, renderer *markdown.Renderer) (io.Writer, func() error) {
+	if renderer == nil {
+		return w, func() error { return nil }
+	}
+	stream := renderer.NewStream(w)
+	return stream, stream.Close
+}
@@ -1,22 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/session"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-type ChatProvider interface {
-	Chat(string, bool) (string, error)
-}
-
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "gq",
@@ -31,8 +29,19 @@ var rootCmd = &cobra.Command{
 
     - Process complex queries with piping:
         cat file.txt | gq -q "Explain this file to me"
+
+    - Ask follow-up questions in a named session:
+        gq --session deploy "How do I roll back the last release?"
+        gq --continue "And how do I verify it worked?"
+
+    - Chat interactively:
+        gq chat
     
     `,
+	Args: cobra.ArbitraryArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return initConfig(cmd)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runCommand(cmd, args)
 	},
@@ -44,7 +53,23 @@ var rootCmd = &cobra.Command{
 func runCommand(cmd *cobra.Command, args []string) error {
 	question, _ := cmd.Flags().GetString("question")
 	verbose, _ := cmd.Flags().GetBool("verbose")
-	provider, _ := cmd.Flags().GetString("provider")
+
+	settings, err := settingsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	if interactive, _ := cmd.Flags().GetBool("interactive"); interactive {
+		if settings.jsonOutput || settings.schema != nil || settings.code != nil {
+			return newUsageError("--json, --schema and --code can't be used in the interactive chat")
+		}
+		return runChat(settings)
+	}
+
+	files, _ := cmd.Flags().GetStringArray("file")
+	if len(args) == 0 && question == "" && len(files) > 0 {
+		return newUsageError("no question provided. Provide -q or a question along with -f")
+	}
 
 	if len(args) == 0 && question == "" {
 		var asciiArt string = `
@@ -75,10 +100,13 @@ func runCommand(cmd *cobra.Command, args []string) error {
 
 	if isInputFromPipe() {
 		if question == "" {
-			return fmt.Errorf("\033[31mno question provided. Provide -q when performing Pipe operations\033[0m")
+			return newUsageError("no question provided. Provide -q when performing Pipe operations")
 		}
 
-		cmdArgs = readFromPipe(os.Stdin)
+		cmdArgs, err = readFromPipe(os.Stdin)
+		if err != nil {
+			return err
+		}
 
 		if verbose {
 			fmt.Println("\033[33mReading from Pipe with contents: \033[0m")
@@ -86,19 +114,57 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		}
 
 	} else {
-		if len(args) != 0 {
-			cmdArgs = args[0]
-		}
+		cmdArgs = strings.Join(args, " ")
 	}
 
-	if provider == "" {
-		provider = viper.GetString("default")
+	content := joinQuestion(question, cmdArgs)
+	attached, images, err := attachFiles(cmd, files)
+	if err != nil {
+		return err
+	}
+	if attached != "" {
+		content = strings.TrimRight(content, "\n") + "\n\n" + attached
+	}
+
+	return answerQuestion(cmd, settings, llm.Message{Role: llm.RoleUser, Content: content, Images: images})
+}
+
+/**
+* This function sends the question, within the session selected with --session
+* or --continue if any, prints the answer and saves the session.
+ */
+func answerQuestion(cmd *cobra.Command, settings callSettings, userMessage llm.Message) error {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	provider := settings.provider
+
+	stream := viper.GetBool("stream")
+	if cmd.Flags().Changed("stream") {
+		stream, _ = cmd.Flags().GetBool("stream")
+	}
+
+	store, conversation, err := openSession(cmd)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case provider != "":
 		if verbose {
-			fmt.Println("\033[33mChatProvider not specified. Using default provider: \033[0m")
+			fmt.Println("\033[33mUsing Chat Provider: \033[0m")
 		}
-	} else {
+	case conversation != nil && conversation.Provider != "":
+		// A session goes on with the provider that holds its history.
+		provider = conversation.Provider
 		if verbose {
-			fmt.Println("\033[33mUsing Chat Provider: \033[0m")
+			fmt.Println("\033[33mChatProvider not specified. Using the provider of the session: \033[0m")
+		}
+	default:
+		provider = viper.GetString("default")
+		if provider == "" {
+			return llm.ConfigError("", "no provider selected. Use -p or set default in the config file")
+		}
+		if verbose {
+			fmt.Println("\033[33mChatProvider not specified. Using default provider: \033[0m")
 		}
 	}
 
@@ -107,11 +173,105 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		fmt.Println("\033[0m")
 	}
 
-	result := askQuestion(question, cmdArgs, provider, verbose)
+	var history []llm.Message
+	if conversation != nil {
+		history = conversation.Messages
+		if verbose {
+			fmt.Printf("\033[33mContinuing session %s with %d previous messages\033[0m\n", conversation.Name, len(history))
+		}
+	}
+	messages := append(history, userMessage)
+	if verbose && settings.system != "" {
+		fmt.Println("\033[33mUsing system prompt: \033[0m")
+		fmt.Println("\033[36m" + settings.system + "\033[0m")
+	}
+	request := llm.ChatRequest{Messages: withSystemPrompt(settings.system, messages), Options: settings.options}
+
+	var answer llm.ChatResponse
+	// codeErr is returned once the session is saved, the answer is worth keeping.
+	var codeErr error
+	switch {
+	case settings.jsonOutput || settings.schema != nil:
+		// JSON is only printed once complete, so it is never streamed.
+		answer, err = answerJSON(provider, settings, request)
+		if err != nil {
+			return err
+		}
+	case settings.code != nil:
+		// Code blocks are only extracted once the answer is complete.
+		answer, err = askQuestion(request, provider)
+		if err != nil {
+			return err
+		}
+		codeErr = writeCode(answer.Text, *settings.code, verbose)
+	case stream:
+		out, flush := answerWriter(os.Stdout, settings.renderer)
+		request.Stream = streamTo(out, verbose)
+		answer, err = askQuestion(request, provider)
+		if err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout)
+	default:
+		answer, err = askQuestion(request, provider)
+		if err != nil {
+			return err
+		}
 
-	SKIP_FORMATTING := provider == "bedrock"
-	write(result, os.Stdout, verbose, SKIP_FORMATTING)
-	return nil
+		text := answer.Text
+		if settings.renderer != nil {
+			if text, err = settings.renderer.Render(text); err != nil {
+				return err
+			}
+		}
+		if err := write(text, os.Stdout, verbose); err != nil {
+			return err
+		}
+	}
+	if err := reportUsage(settings.usage, provider, settings.options, answer.Usage); err != nil {
+		return err
+	}
+
+	if conversation != nil {
+		conversation.Provider = provider
+		conversation.Messages = append(messages, llm.Message{Role: llm.RoleAssistant, Content: answer.Text})
+		if err := store.Save(conversation); err != nil {
+			return err
+		}
+	}
+	return codeErr
+}
+
+/**
+* This function opens the session selected with --session or --continue.
+* It returns a nil session when the call is a one-shot question.
+ */
+func openSession(cmd *cobra.Command) (*session.Store, *session.Session, error) {
+	name, _ := cmd.Flags().GetString("session")
+	continueLast, _ := cmd.Flags().GetBool("continue")
+	if name == "" && !continueLast {
+		return nil, nil, nil
+	}
+
+	store, err := session.NewStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	if name == "" {
+		name, err = store.Last()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conversation, err := store.Load(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	return store, conversation, nil
 }
 
 /*
@@ -123,98 +283,164 @@ func isInputFromPipe() bool {
 }
 
 /**
-* This function asks a question to the provider and returns the answer
+* This function combines the question with the data it is about
  */
-func askQuestion(question string, data string, provider string, verbose bool) string {
+func joinQuestion(question string, data string) string {
 	var extraMiddleCharacter string = "\n"
 	if question == "" {
 		extraMiddleCharacter = ""
 	}
 
-	inputQuestion := question + extraMiddleCharacter + data
+	return question + extraMiddleCharacter + data
+}
 
-	if verbose {
+/**
+* This function asks a question to the provider and returns the answer.
+* The last message is the question, any earlier ones are the conversation history.
+* When req.Stream is set the answer is also streamed through it as it arrives.
+ */
+func askQuestion(req llm.ChatRequest, provider string) (llm.ChatResponse, error) {
+	if req.Options.Verbose {
 		fmt.Println("\033[33mMaking LLM Call with question: \033[0m")
-		fmt.Println("\033[36m" + inputQuestion + "\033[0m")
+		fmt.Println("\033[36m" + req.Messages[len(req.Messages)-1].Content + "\033[0m")
 	}
 
-	chatProvider := getChatProvider(provider)
-
-	answer, err := chatProvider.Chat(inputQuestion, verbose)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return strings.Trim(answer, `"`)
+	return sendChat(context.Background(), provider, req)
 }
 
 /**
 * This function reads the data from the pipe and asks questions and write it as output
  */
-func readFromPipe(reader io.Reader) string {
+func readFromPipe(reader io.Reader) (string, error) {
 	inputBytes, err := io.ReadAll(reader)
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("error reading from pipe: %w", err)
 	}
 
-	return string(inputBytes)
-}
-
-func unquote(s string, skip bool) string {
-	if skip {
-		return s
-	}
-	unquoted, err := strconv.Unquote(`"` + s + `"`)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return unquoted
+	return string(inputBytes), nil
 }
 
 /**
 * This function writes the result as output
  */
-func write(s string, w io.Writer, verbose bool, skipUnquoted bool) error {
-	unquoted := unquote(s, skipUnquoted)
+func write(s string, w io.Writer, verbose bool) error {
 	if verbose {
 		fmt.Println("\033[32m---LLM Output---\033[0m")
 	}
-	_, e := fmt.Fprintln(w, unquoted)
+	_, err := fmt.Fprintln(w, s)
+	return err
+}
 
-	if e != nil {
-		log.Fatal(e)
-		return e
+/**
+* This function returns a stream handler that writes every chunk to w as it arrives.
+* The verbose output header is printed lazily on the first chunk so it never
+* interleaves with the verbose logs printed while the call is being made.
+ */
+func streamTo(w io.Writer, verbose bool) llm.StreamFunc {
+	started := false
+	return func(chunk string) error {
+		if !started {
+			started = true
+			if verbose {
+				fmt.Println("\033[32m---LLM Output---\033[0m")
+			}
+		}
+		_, err := io.WriteString(w, chunk)
+		return err
 	}
-	return nil
 }
 
-func getChatProvider(provider string) ChatProvider {
+/**
+* This function sends the conversation to the provider. It is shared by the
+* one-shot mode and the interactive chat so both behave the same.
+ */
+func sendChat(ctx context.Context, provider string, req llm.ChatRequest) (llm.ChatResponse, error) {
+	chatProvider, err := newChatProvider(provider)
+	if err != nil {
+		return llm.ChatResponse{}, err
+	}
+	if err := checkBudget(provider); err != nil {
+		return llm.ChatResponse{}, err
+	}
+
+	start := time.Now()
+	response, err := chatProvider.Chat(ctx, req)
+	recordCall(provider, modelName(provider, req.Options), start, response.Usage, 0, err)
+	return response, err
+}
+
+/**
+* This function returns the provider with the given name, either a built-in
+* one or an OpenAI-compatible endpoint from the config, wrapped in the retry
+* and rate limit layer configured for it.
+ */
+func newChatProvider(provider string) (llm.ChatProvider, error) {
+	var chatProvider llm.ChatProvider
 	switch provider {
 	case "gemini":
-		return llm.GeminiProvider{}
+		chatProvider = llm.GeminiProvider{}
 	case "openAI":
-		return llm.OpenAIProvider{}
+		chatProvider = llm.OpenAIProvider{}
 	case "azureOpenAI":
-		return llm.AzureOpenAIProvider{}
+		chatProvider = llm.AzureOpenAIProvider{}
 	case "bedrock":
-		return llm.AmznBedrockAIProvider{}
-	default:
-		panic("Unknown provider")
+		chatProvider = llm.AmznBedrockAIProvider{}
+	case "ollama":
+		chatProvider = llm.OllamaProvider{}
+	case "anthropic":
+		chatProvider = llm.AnthropicProvider{}
 	}
+
+	section, ok := providerSection(provider)
+	if !ok {
+		return nil, llm.ConfigError("", "unknown provider %q. Use one of %s", provider, strings.Join(allProviderNames(), ", "))
+	}
+	if chatProvider == nil {
+		chatProvider = llm.NewOpenAICompatibleProvider(strings.TrimPrefix(section, "endpoints."))
+	}
+
+	// Without a state directory the rate limit is not enforced, retries still are.
+	stateDir, _ := session.StateDir()
+	return llm.WithRetry(provider, section, chatProvider, stateDir), nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Errors are printed to stderr and turned into the exit codes listed in errors.go.
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(renderError(os.Stderr, err))
 	}
 }
 
 func init() {
+	rootCmd.SilenceUsage = true
+	rootCmd.SilenceErrors = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return newUsageError("%s", err)
+	})
+
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().StringP("provider", "p", "", "the llm provider to use")
-	rootCmd.PersistentFlags().StringP("config", "c", "", "config file (default is $HOME/.config/gq/.gq.yaml)")
+	rootCmd.PersistentFlags().StringP("config", "c", "", "config file merged over all other config layers")
+	rootCmd.PersistentFlags().StringP("model", "m", "", "model to use, overriding the provider's modelName")
+	rootCmd.PersistentFlags().Float64("temperature", 0, "sampling temperature, overriding the provider's config")
+	rootCmd.PersistentFlags().Int("max-tokens", 0, "maximum number of tokens to generate, overriding the provider's config")
+	rootCmd.PersistentFlags().Float64("top-p", 0, "nucleus sampling probability, overriding the provider's config")
+	rootCmd.PersistentFlags().String("system", "", "system prompt sent ahead of the conversation")
+	rootCmd.PersistentFlags().String("system-file", "", "file holding the system prompt")
+	rootCmd.PersistentFlags().String("persona", "", "persona from the config file setting the system prompt, provider, model and temperature")
+	rootCmd.PersistentFlags().String("usage", "", "print the token usage and estimated cost of every call to stderr, as text or json")
+	rootCmd.PersistentFlags().Lookup("usage").NoOptDefVal = "text"
+	rootCmd.PersistentFlags().Bool("stream", false, "stream the answer as it is generated (default from the stream config key)")
+	rootCmd.PersistentFlags().Bool("raw", false, "print the answer as raw markdown, even on a terminal")
+	rootCmd.PersistentFlags().Bool("render", false, "render the answer's markdown, even when stdout is not a terminal")
 	rootCmd.Flags().StringP("question", "q", "", "Question about the data sent")
+	rootCmd.Flags().StringArrayP("file", "f", nil, "file, glob or directory to attach to the question, can be repeated")
+	rootCmd.Flags().Int64("max-file-size", 0, "size in bytes above which attached files are skipped (default from files.maxSize, 1 MiB)")
+	rootCmd.Flags().StringP("session", "s", "", "name of the conversation session to start or continue")
+	rootCmd.Flags().BoolP("continue", "C", false, "continue the last used session (capital C, -c is --config)")
+	rootCmd.Flags().BoolP("interactive", "i", false, "start an interactive chat (same as gq chat)")
+	addJSONFlags(rootCmd)
+	addCodeFlags(rootCmd)
 }
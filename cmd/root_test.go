@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/session"
+	"github.com/spf13/cobra"
+)
+
+/**
+* This function returns a command with the flags answerQuestion reads
+ */
+func sessionCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	cmd := &cobra.Command{}
+	cmd.Flags().StringP("session", "s", "", "")
+	cmd.Flags().BoolP("continue", "C", false, "")
+	cmd.Flags().Bool("stream", false, "")
+	cmd.Flags().Bool("verbose", false, "")
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestAnswerQuestionContinuesWithTheSessionProvider(t *testing.T) {
+	var calls []llm.OllamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got llm.OllamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		calls = append(calls, got)
+		json.NewEncoder(w).Encode(map[string]any{
+			"message": map[string]string{"role": "assistant", "content": "ok"},
+			"done":    true,
+		})
+	}))
+	defer server.Close()
+	// No default provider, only the session tells which one to use.
+	loadTestConfig(t, "ollama:\n  host: "+server.URL+"\n  modelName: llama3\n")
+
+	question := func(content string) llm.Message {
+		return llm.Message{Role: llm.RoleUser, Content: content}
+	}
+	if err := answerQuestion(sessionCommand(t, "-s", "s1"), callSettings{provider: "ollama"}, question("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := answerQuestion(sessionCommand(t, "-C"), callSettings{}, question("again")); err != nil {
+		t.Fatalf("continuing with -C: %v", err)
+	}
+	if err := answerQuestion(sessionCommand(t, "-s", "s1"), callSettings{}, question("and again")); err != nil {
+		t.Fatalf("continuing with -s: %v", err)
+	}
+
+	if len(calls) != 3 || len(calls[1].Messages) != 3 || len(calls[2].Messages) != 5 {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+	store, err := session.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.Load("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Provider != "ollama" || len(saved.Messages) != 6 {
+		t.Errorf("unexpected session %+v", saved)
+	}
+}
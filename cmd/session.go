@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/avinashsivaraman/gq/cmd/session"
+	"github.com/spf13/cobra"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage saved conversation sessions",
+	Long: `
+  Sessions keep the history of a conversation so follow-up questions don't have to repeat the context.
+
+  Usage examples:
+    - Start or continue a named session:
+        gq --session deploy "How do I roll back the last release?"
+
+    - Continue the last used session:
+        gq --continue "And how do I verify it worked?"
+    `,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved sessions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := session.NewStore()
+		if err != nil {
+			return err
+		}
+		sessions, err := store.List()
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No saved sessions")
+			return nil
+		}
+		for _, s := range sessions {
+			fmt.Printf("%-20s %3d messages  %s\n", s.Name, len(s.Messages), s.UpdatedAt.Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+var sessionShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Print the transcript of a session",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := loadExistingSession(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(s.Markdown())
+		return nil
+	},
+}
+
+var sessionRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "Delete one or more sessions",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := session.NewStore()
+		if err != nil {
+			return err
+		}
+		for _, name := range args {
+			if err := store.Remove(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var sessionExportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Export a session as markdown or JSON",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		s, err := loadExistingSession(args[0])
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		switch format {
+		case "markdown", "md":
+			data = []byte(s.Markdown())
+		case "json":
+			data, err = json.MarshalIndent(s, "", "  ")
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+		default:
+			return newUsageError("unknown export format %q. Use markdown or json", format)
+		}
+
+		if output == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return os.WriteFile(output, data, 0o600)
+	},
+}
+
+func loadExistingSession(name string) (*session.Session, error) {
+	store, err := session.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	s, err := store.Load(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("session %q does not exist", name)
+	}
+	return s, err
+}
+
+func init() {
+	sessionExportCmd.Flags().StringP("format", "f", "markdown", "export format: markdown or json")
+	sessionExportCmd.Flags().StringP("output", "o", "", "file to write to (default stdout)")
+
+	sessionCmd.AddCommand(sessionListCmd, sessionShowCmd, sessionRmCmd, sessionExportCmd)
+	rootCmd.AddCommand(sessionCmd)
+}
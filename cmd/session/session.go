@@ -0,0 +1,186 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+)
+
+// lastSessionFile records the name of the most recently used session.
+const lastSessionFile = ".last"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Session is a named conversation whose turns are replayed to the provider.
+type Session struct {
+	Name      string        `json:"name"`
+	Provider  string        `json:"provider,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	Messages  []llm.Message `json:"messages"`
+}
+
+// Store keeps one JSON file per session in a directory.
+type Store struct {
+	Dir string
+}
+
+// StateDir returns the directory gq keeps its state in: $XDG_STATE_HOME/gq
+// when XDG_STATE_HOME is set, and $HOME/.config/gq otherwise.
+func StateDir() (string, error) {
+	if stateHome := os.Getenv("XDG_STATE_HOME"); stateHome != "" {
+		return filepath.Join(stateHome, "gq"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gq"), nil
+}
+
+// DefaultDir returns the sessions directory inside StateDir.
+func DefaultDir() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+// NewStore returns a store rooted at DefaultDir.
+func NewStore() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Dir: dir}, nil
+}
+
+func (s *Store) path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q. Use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(s.Dir, name+".json"), nil
+}
+
+// Load reads a session. A session that does not exist yet is returned empty
+// together with an error satisfying errors.Is(err, os.ErrNotExist).
+func (s *Store) Load(name string) (*Session, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		now := time.Now()
+		return &Session{Name: name, CreatedAt: now, UpdatedAt: now}, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("session %q is corrupted: %w", name, err)
+	}
+	return &session, nil
+}
+
+// Save writes the session and marks it as the last one used.
+func (s *Store) Save(session *Session) error {
+	path, err := s.path(session.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+
+	session.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, lastSessionFile), []byte(session.Name), 0o600)
+}
+
+// Last returns the name of the most recently saved session.
+func (s *Store) Last() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, lastSessionFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.New("no previous session to continue. Start one with --session <name>")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// List returns every stored session, most recently updated first.
+func (s *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		session, err := s.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// Remove deletes a session, clearing the last-used marker if it pointed at it.
+func (s *Store) Remove(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("session %q does not exist", name)
+		}
+		return err
+	}
+	if last, err := s.Last(); err == nil && last == name {
+		os.Remove(filepath.Join(s.Dir, lastSessionFile))
+	}
+	return nil
+}
+
+// Markdown renders the session as a readable transcript.
+func (session *Session) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", session.Name)
+	for _, m := range session.Messages {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", strings.ToUpper(string(m.Role[:1]))+string(m.Role[1:]), m.Content)
+	}
+	return b.String()
+}
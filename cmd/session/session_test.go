@@ -0,0 +1,116 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+)
+
+func TestSaveLoad(t *testing.T) {
+	store := &Store{Dir: filepath.Join(t.TempDir(), "sessions")}
+
+	session, err := store.Load("deploy")
+	if !errors.Is(err, os.ErrNotExist) || session == nil || session.Name != "deploy" || len(session.Messages) != 0 {
+		t.Fatalf("new session: got %+v, %v", session, err)
+	}
+
+	session.Provider = "ollama"
+	session.Messages = []llm.Message{
+		{Role: llm.RoleUser, Content: "How do I roll back?"},
+		{Role: llm.RoleAssistant, Content: "Run the rollback job."},
+	}
+	if err := store.Save(session); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Provider != "ollama" || len(loaded.Messages) != 2 || loaded.Messages[1].Content != "Run the rollback job." {
+		t.Errorf("unexpected session %+v", loaded)
+	}
+	if last, err := store.Last(); err != nil || last != "deploy" {
+		t.Errorf("last: got %q, %v", last, err)
+	}
+	if markdown := loaded.Markdown(); !strings.Contains(markdown, "## Assistant\n\nRun the rollback job.") {
+		t.Errorf("unexpected transcript %q", markdown)
+	}
+
+	if err := os.WriteFile(filepath.Join(store.Dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("broken"); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("got %v, want an error saying the session is corrupted", err)
+	}
+}
+
+func TestListRemove(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+
+	if _, err := store.Last(); err == nil {
+		t.Error("expected an error when no session was used yet")
+	}
+	for _, name := range []string{"first", "second", "third"} {
+		if err := store.Save(&Session{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files that aren't sessions are ignored.
+	os.Mkdir(filepath.Join(store.Dir, "archive.json"), 0o700)
+
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range sessions {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "third,second,first" {
+		t.Errorf("got %v, want the most recently updated first", names)
+	}
+
+	if err := store.Remove("third"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Last(); err == nil {
+		t.Error("the last session marker outlived the session")
+	}
+	if err := store.Remove("third"); err == nil {
+		t.Error("expected an error removing a missing session")
+	}
+}
+
+func TestNames(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	for _, name := range []string{"deploy", "v1.2", "team_a-notes", "A"} {
+		if err := store.Save(&Session{Name: name}); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../escape", "a/b", ".hidden", "-flag", "with space"} {
+		if err := store.Save(&Session{Name: name}); err == nil {
+			t.Errorf("%q: expected an invalid name error", name)
+		}
+		if _, err := store.Load(name); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%q: got %v, want an invalid name error", name, err)
+		}
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/tmp/state")
+	if dir, err := StateDir(); err != nil || dir != filepath.Join("/tmp/state", "gq") {
+		t.Errorf("got %q, %v", dir, err)
+	}
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", "/home/someone")
+	if dir, err := StateDir(); err != nil || dir != filepath.Join("/home/someone", ".config", "gq") {
+		t.Errorf("got %q, %v", dir, err)
+	}
+}
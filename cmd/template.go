@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/templates"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newTemplate is the text of the templates created by gq template new when nothing is piped.
+const newTemplate = `{{/* Rendered by gq run %s. Variables come from --var key=value or GQ_VAR_key,
+     piped data is {{.Input}}, {{env "NAME"}} reads an environment variable
+     and {{include "path"}} inserts a file. */}}
+`
+
+var runCmd = &cobra.Command{
+	Use:   "run <template>",
+	Short: "Render a prompt template and ask it",
+	Long: `
+  Renders a prompt template with Go text/template and sends the result as the question.
+
+  Usage examples:
+    - Fill the variables of a template:
+        gq run release-notes --var version=1.4.0
+
+    - Pipe the data the template refers to as {{.Input}}:
+        git diff | gq run review --var focus=security
+    `,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := settingsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		question, err := renderTemplate(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+			fmt.Println("\033[33mRendered template " + args[0] + ": \033[0m")
+			fmt.Println("\033[36m" + question + "\033[0m")
+		}
+		return answerQuestion(cmd, settings, llm.Message{Role: llm.RoleUser, Content: question})
+	},
+}
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage prompt templates",
+	Long: `
+  Prompt templates are reusable prompts kept in the templates directory,
+  ~/.config/gq/templates unless templates.dir is set in the config file.
+  Run them with gq run <template>.
+    `,
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the prompt templates",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := templateStore()
+		if err != nil {
+			return err
+		}
+		names, err := store.List()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println("No templates in " + store.Dir)
+			return nil
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	},
+}
+
+var templateShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Print a prompt template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := templateStore()
+		if err != nil {
+			return err
+		}
+		text, err := store.Read(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(text)
+		return nil
+	},
+}
+
+var templateNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "Create a prompt template, from the piped text if any",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := templateStore()
+		if err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf(newTemplate, args[0])
+		if isInputFromPipe() {
+			text, err = readFromPipe(os.Stdin)
+			if err != nil {
+				return err
+			}
+		}
+
+		path, err := store.Create(args[0], text)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\033[33mCreated %s. Run it with gq run %s\033[0m\n", path, args[0])
+		return nil
+	},
+}
+
+/**
+* This function returns the store of the templates directory, templates.dir
+* or the templates directory next to the user-wide config file
+ */
+func templateStore() (*templates.Store, error) {
+	if dir := viper.GetString("templates.dir"); dir != "" {
+		return &templates.Store{Dir: dir}, nil
+	}
+	global, err := globalConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return &templates.Store{Dir: filepath.Join(filepath.Dir(global), "templates")}, nil
+}
+
+/**
+* This function renders the template with the --var variables and the piped data
+ */
+func renderTemplate(cmd *cobra.Command, name string) (string, error) {
+	store, err := templateStore()
+	if err != nil {
+		return "", err
+	}
+	text, err := store.Read(name)
+	if err != nil {
+		return "", err
+	}
+
+	data := templates.Data{Vars: map[string]string{}, Strict: viper.GetBool("templates.strict")}
+	if cmd.Flags().Changed("strict") {
+		data.Strict, _ = cmd.Flags().GetBool("strict")
+	}
+
+	vars, _ := cmd.Flags().GetStringArray("var")
+	for _, v := range vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return "", newUsageError("invalid --var %q. Use --var key=value", v)
+		}
+		data.Vars[key] = value
+	}
+
+	if isInputFromPipe() {
+		input, err := readFromPipe(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		data.Input = &input
+	}
+
+	rendered, err := templates.Render(name, text, data)
+	if err != nil {
+		return "", fmt.Errorf("rendering template %s: %w", name, err)
+	}
+	return rendered, nil
+}
+
+func init() {
+	runCmd.Flags().StringArray("var", nil, "template variable as key=value, can be repeated")
+	runCmd.Flags().Bool("strict", false, "fail on missing variables instead of leaving them empty (default from templates.strict)")
+	runCmd.Flags().StringP("session", "s", "", "name of the conversation session to start or continue")
+	runCmd.Flags().BoolP("continue", "C", false, "continue the last used session (capital C, -c is --config)")
+	addJSONFlags(runCmd)
+	addCodeFlags(runCmd)
+
+	templateCmd.AddCommand(templateListCmd, templateShowCmd, templateNewCmd)
+	rootCmd.AddCommand(runCmd, templateCmd)
+}
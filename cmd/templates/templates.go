@@ -0,0 +1,155 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// extension is the file extension of the templates in a Store.
+const extension = ".tmpl"
+
+// varEnvPrefix is the prefix of the environment variables providing template
+// variables, e.g. GQ_VAR_lang provides {{.lang}}.
+const varEnvPrefix = "GQ_VAR_"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Store keeps one prompt template per file in a directory.
+type Store struct {
+	Dir string
+}
+
+// Path returns the file holding the template.
+func (s *Store) Path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid template name %q. Use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(s.Dir, name+extension), nil
+}
+
+// Read returns the text of a template.
+func (s *Store) Read(name string) (string, error) {
+	path, err := s.Path(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("template %q does not exist in %s. Create it with gq template new %s", name, s.Dir, name)
+	}
+	return string(data), err
+}
+
+// Create writes a new template. It refuses to overwrite an existing one.
+func (s *Store) Create(name string, text string) (string, error) {
+	path, err := s.Path(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("template %q already exists at %s", name, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// List returns the names of the stored templates in alphabetical order.
+func (s *Store) List() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), extension)
+		if entry.IsDir() || !ok {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Data is what a template is rendered with.
+type Data struct {
+	// Vars are the variables given with --var. They win over the GQ_VAR_
+	// environment variables.
+	Vars map[string]string
+	// Input is the data piped to gq, available as {{.Input}} when set.
+	Input *string
+	// Strict makes missing variables and environment variables an error
+	// instead of an empty string.
+	Strict bool
+}
+
+// Render executes the template text. Besides the variables it can use
+// {{env "NAME"}} to read an environment variable and {{include "path"}} to
+// insert the contents of a file, relative to the current directory. A file
+// that can't be read is always an error.
+func Render(name string, text string, data Data) (string, error) {
+	values := map[string]string{}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if variable, ok := strings.CutPrefix(key, varEnvPrefix); ok && variable != "" {
+			values[variable] = value
+		}
+	}
+	for key, value := range data.Vars {
+		values[key] = value
+	}
+	if data.Input != nil {
+		values["Input"] = *data.Input
+	}
+
+	missingKey := "missingkey=zero"
+	if data.Strict {
+		missingKey = "missingkey=error"
+	}
+
+	tmpl, err := template.New(name).Option(missingKey).Funcs(template.FuncMap{
+		"env": func(key string) (string, error) {
+			value, ok := os.LookupEnv(key)
+			if !ok && data.Strict {
+				return "", fmt.Errorf("environment variable %s is not set", key)
+			}
+			return value, nil
+		},
+		"include": func(path string) (string, error) {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return string(contents), nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, values); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,82 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	include := filepath.Join(t.TempDir(), "style.md")
+	if err := os.WriteFile(include, []byte("Be brief."), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GQ_VAR_lang", "Go")
+	t.Setenv("GQ_VAR_focus", "style")
+	t.Setenv("TEAM", "platform")
+
+	input := "func main() {}"
+	text := `Review this {{.lang}} code for {{.focus}} ({{env "TEAM"}}). {{include .style}}
+{{.Input}}`
+	got, err := Render("review", text, Data{
+		Vars:  map[string]string{"focus": "security", "style": include},
+		Input: &input,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Review this Go code for security (platform). Be brief.\nfunc main() {}"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderMissing(t *testing.T) {
+	for name, text := range map[string]string{
+		"variable": "Hello {{.name}}",
+		"input":    "Hello {{.Input}}",
+		"env":      `Hello {{env "GQ_TEST_UNSET"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := Render(name, text, Data{})
+			if err != nil || got != "Hello " {
+				t.Errorf("got %q and error %v, want %q", got, err, "Hello ")
+			}
+
+			if _, err := Render(name, text, Data{Strict: true}); err == nil {
+				t.Error("strict mode accepted a missing value")
+			}
+		})
+	}
+
+	_, err := Render("include", `{{include "does-not-exist.md"}}`, Data{})
+	if err == nil || !strings.Contains(err.Error(), "does-not-exist.md") {
+		t.Errorf("got error %v, want one naming the missing file", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := &Store{Dir: filepath.Join(t.TempDir(), "templates")}
+	if names, err := store.List(); err != nil || len(names) != 0 {
+		t.Fatalf("got %v and error %v from an empty store", names, err)
+	}
+
+	if _, err := store.Create("review", "Review {{.Input}}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("review", "again"); err == nil {
+		t.Error("Create overwrote an existing template")
+	}
+	if _, err := store.Create("../escape", "x"); err == nil {
+		t.Error("Create accepted a name outside of the store")
+	}
+
+	text, err := store.Read("review")
+	if err != nil || text != "Review {{.Input}}" {
+		t.Errorf("got %q and error %v", text, err)
+	}
+	if names, _ := store.List(); strings.Join(names, ",") != "review" {
+		t.Errorf("got templates %v, want [review]", names)
+	}
+}
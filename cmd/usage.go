@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/avinashsivaraman/gq/cmd/ledger"
+	"github.com/avinashsivaraman/gq/cmd/llm"
+	"github.com/avinashsivaraman/gq/cmd/session"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// dateLayout is the layout of the dates given to gq usage.
+const dateLayout = "2006-01-02"
+
+// usageSummary is the output of gq usage --format json.
+type usageSummary struct {
+	From   string         `json:"from,omitempty"`
+	To     string         `json:"to,omitempty"`
+	By     []string       `json:"by"`
+	Groups []ledger.Group `json:"groups"`
+	Total  ledger.Group   `json:"total"`
+}
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report the tokens and estimated cost of past calls",
+	Long: `
+  Every call is recorded in a local usage ledger, with its tokens, estimated cost, latency and outcome.
+  gq usage sums it up for the current month unless a date range is given.
+
+  Usage examples:
+    - Spending of the current month per day:
+        gq usage
+
+    - Spending per provider and model over a date range:
+        gq usage --by provider,model --from 2024-05-01 --to 2024-05-31
+
+    - Export every recorded call of the year, grouped by month, as CSV:
+        gq usage --by month --from 2024-01-01 --format csv -o usage.csv
+    `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		by, _ := flags.GetStringSlice("by")
+		format, _ := flags.GetString("format")
+		output, _ := flags.GetString("output")
+		all, _ := flags.GetBool("all")
+		if format != "table" && format != "csv" && format != "json" {
+			return newUsageError("unknown format %q. Use table, csv or json", format)
+		}
+
+		from, err := dateFlag(cmd, "from")
+		if err != nil {
+			return err
+		}
+		to, err := dateFlag(cmd, "to")
+		if err != nil {
+			return err
+		}
+		if !to.IsZero() {
+			// --to is inclusive.
+			to = to.AddDate(0, 0, 1)
+		}
+		if from.IsZero() && to.IsZero() && !all {
+			from = monthStart(time.Now())
+		}
+
+		l, err := openLedger()
+		if err != nil {
+			return err
+		}
+		entries, err := l.Entries(from, to)
+		if err != nil {
+			return err
+		}
+		groups, err := ledger.Summarize(entries, by, time.Local)
+		if err != nil {
+			return newUsageError("%s", err)
+		}
+		total, _ := ledger.Summarize(entries, nil, time.Local)
+
+		summary := usageSummary{By: by, Groups: groups}
+		if len(total) > 0 {
+			summary.Total = total[0]
+		}
+		if !from.IsZero() {
+			summary.From = from.Format(dateLayout)
+		}
+		if !to.IsZero() {
+			summary.To = to.AddDate(0, 0, -1).Format(dateLayout)
+		}
+
+		w := io.Writer(os.Stdout)
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch format {
+		case "table":
+			if err := writeUsageTable(w, summary); err != nil {
+				return err
+			}
+			if output == "" {
+				return printBudgets(w)
+			}
+			return nil
+		case "csv":
+			return writeUsageCSV(w, summary)
+		case "json":
+			data, err := json.MarshalIndent(summary, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(w, string(data))
+			return err
+		}
+		return nil
+	},
+}
+
+/**
+* This function returns the date given with the flag, at midnight local time,
+* or the zero time when the flag is not set
+ */
+func dateFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, newUsageError("invalid --%s %q. Use YYYY-MM-DD", name, value)
+	}
+	return date, nil
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func writeUsageTable(w io.Writer, summary usageSummary) error {
+	if summary.Total.Calls == 0 {
+		_, err := fmt.Fprintln(w, "No calls recorded"+usagePeriod(summary))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := append(upper(summary.By), "CALLS", "FAILED", "PROMPT", "COMPLETION", "TOTAL", "COST", "AVG LATENCY", "")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	row := func(keys []string, g ledger.Group) {
+		cost := fmt.Sprintf("$%.4f", g.Cost)
+		if g.Unpriced > 0 {
+			cost += "*"
+		}
+		values := append(append([]string{}, keys...), strconv.Itoa(g.Calls), strconv.Itoa(g.Failed), strconv.Itoa(g.PromptTokens),
+			strconv.Itoa(g.CompletionTokens), strconv.Itoa(g.TotalTokens), cost, fmt.Sprintf("%dms", g.AverageLatencyMS), "")
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	for _, g := range summary.Groups {
+		row(g.Keys, g)
+	}
+	totalKeys := make([]string, len(summary.By))
+	if len(totalKeys) > 0 {
+		totalKeys[0] = "Total"
+	}
+	row(totalKeys, summary.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if summary.Total.Unpriced > 0 {
+		fmt.Fprintf(w, "* %d call(s) without a price for their model. Set prices in the config file to include them\n", summary.Total.Unpriced)
+	}
+	_, err := fmt.Fprintln(w, strings.TrimPrefix(usagePeriod(summary), " "))
+	return err
+}
+
+func usagePeriod(summary usageSummary) string {
+	switch {
+	case summary.From != "" && summary.To != "":
+		return " from " + summary.From + " to " + summary.To
+	case summary.From != "":
+		return " since " + summary.From
+	case summary.To != "":
+		return " until " + summary.To
+	}
+	return ""
+}
+
+func writeUsageCSV(w io.Writer, summary usageSummary) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append(append([]string{}, summary.By...), "calls", "failed", "promptTokens", "completionTokens", "totalTokens", "cost", "unpriced", "averageLatencyMs"))
+	for _, g := range summary.Groups {
+		cw.Write(append(append([]string{}, g.Keys...), strconv.Itoa(g.Calls), strconv.Itoa(g.Failed),
+			strconv.Itoa(g.PromptTokens), strconv.Itoa(g.CompletionTokens), strconv.Itoa(g.TotalTokens),
+			strconv.FormatFloat(g.Cost, 'f', 6, 64), strconv.Itoa(g.Unpriced), strconv.FormatInt(g.AverageLatencyMS, 10)))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// dollars formats an amount in dollars, with more decimals for amounts under a cent.
+func dollars(amount float64) string {
+	if amount != 0 && amount < 0.01 {
+		return fmt.Sprintf("$%.4f", amount)
+	}
+	return fmt.Sprintf("$%.2f", amount)
+}
+
+func upper(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToUpper(v)
+	}
+	return out
+}
+
+/**
+* This function returns the usage ledger in the state directory of gq
+ */
+func openLedger() (*ledger.Ledger, error) {
+	dir, err := session.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return &ledger.Ledger{Path: filepath.Join(dir, ledger.FileName)}, nil
+}
+
+/**
+* This function records a call in the usage ledger, unless ledger.enabled is
+* false. A ledger that can't be written only gets a warning, the answer matters more.
+ */
+func recordCall(provider string, model string, start time.Time, usage llm.Usage, images int, callErr error) {
+	if viper.IsSet("ledger.enabled") && !viper.GetBool("ledger.enabled") {
+		return
+	}
+
+	entry := ledger.Entry{
+		Time:      start,
+		Provider:  provider,
+		Model:     model,
+		Images:    images,
+		LatencyMS: time.Since(start).Milliseconds(),
+		Success:   callErr == nil,
+	}
+	if callErr != nil {
+		entry.Error = llm.KindOf(callErr).String()
+	} else if report, err := newUsageReport(provider, model, usage); err == nil {
+		entry.PromptTokens = report.PromptTokens
+		entry.CompletionTokens = report.CompletionTokens
+		entry.TotalTokens = report.TotalTokens
+		entry.Cost = report.EstimatedCost
+	}
+
+	l, err := openLedger()
+	if err == nil {
+		err = l.Append(entry)
+	}
+	if err != nil {
+		printWarnings([]string{"couldn't record the call in the usage ledger: " + err.Error()})
+	}
+}
+
+// budget is a monthly spending limit, of every provider when provider is empty.
+type budget struct {
+	provider string
+	key      string
+	limit    float64
+}
+
+/**
+* This function returns the budgets that apply to calls to the provider:
+* budget.monthly and the monthlyBudget of its section
+ */
+func budgets(provider string) []budget {
+	var list []budget
+	if limit := viper.GetFloat64("budget.monthly"); limit > 0 {
+		list = append(list, budget{key: "budget.monthly", limit: limit})
+	}
+	if section, ok := providerSection(provider); ok && provider != "" {
+		if limit := viper.GetFloat64(section + ".monthlyBudget"); limit > 0 {
+			list = append(list, budget{provider: provider, key: section + ".monthlyBudget", limit: limit})
+		}
+	}
+	return list
+}
+
+/**
+* This function checks the spending of the current month against the
+* budgets of the provider. An exceeded budget is a warning, or an error when
+* budget.action is refuse.
+ */
+func checkBudget(provider string) error {
+	list := budgets(provider)
+	if len(list) == 0 {
+		return nil
+	}
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	start := monthStart(time.Now())
+	entries, err := l.Entries(start, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, b := range list {
+		spent := ledger.Spent(entries, b.provider)
+		if spent < b.limit {
+			continue
+		}
+		message := fmt.Sprintf("the monthly budget of %s set by %s is exceeded: %s spent since %s", dollars(b.limit), b.key, dollars(spent), start.Format(dateLayout))
+		if viper.GetString("budget.action") == "refuse" {
+			return &llm.Error{Kind: llm.ErrQuota, Provider: provider, Message: message + ". Raise the budget, or set budget.action: warn to only be warned"}
+		}
+		printWarnings([]string{message})
+	}
+	return nil
+}
+
+/**
+* This function prints how much of every budget is spent this month
+ */
+func printBudgets(w io.Writer) error {
+	var list []budget
+	seen := map[string]bool{}
+	for _, name := range append([]string{""}, allProviderNames()...) {
+		for _, b := range budgets(name) {
+			if !seen[b.key] {
+				seen[b.key] = true
+				list = append(list, b)
+			}
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	entries, err := l.Entries(monthStart(time.Now()), time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, b := range list {
+		spent := ledger.Spent(entries, b.provider)
+		if _, err := fmt.Fprintf(w, "Budget %s: %s of %s spent this month (%.0f%%)\n", b.key, dollars(spent), dollars(b.limit), 100*spent/b.limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	usageCmd.Flags().StringSlice("by", []string{"day"}, "group the calls by day, month, provider or model, e.g. --by day,provider")
+	usageCmd.Flags().String("from", "", "first day of the report, YYYY-MM-DD (default the first day of the current month)")
+	usageCmd.Flags().String("to", "", "last day of the report, YYYY-MM-DD, included")
+	usageCmd.Flags().Bool("all", false, "report every recorded call rather than the current month")
+	usageCmd.Flags().String("format", "table", "output format: table, csv or json")
+	usageCmd.Flags().StringP("output", "o", "", "write the report to a file instead of stdout")
+
+	rootCmd.AddCommand(usageCmd)
+}